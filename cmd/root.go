@@ -1,27 +1,33 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/cert"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/config"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/money"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/server"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/service"
-	log "github.com/sirupsen/logrus"
-	"io/ioutil"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/tracing"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 const serviceName = "go-grpc-server-shop"
 
 var (
-	cfgFile string
-	cfg     config.Configuration
+	cfgFile  string
+	cfg      config.Configuration
+	log      *zap.SugaredLogger
+	logLevel zap.AtomicLevel
 )
 
 func init() {
@@ -40,25 +46,86 @@ var rootCmd = &cobra.Command{
 	Long:              "GO gRPC Server with simple shop like CRUD API",
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		cfg = config.MustParse(cfgFile)
+		logger, level, err := logging.New(cfg.Log)
+		if err != nil {
+			return err
+		}
+		log, logLevel = logger.Sugar(), level
+		if !money.IsCurrency(cfg.Service.V1Currency) {
+			return errors.Errorf("unknown v1 currency code '%s'", cfg.Service.V1Currency)
+		}
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		defer log.Sync() //nolint:errcheck
+
+		shutdownTracing, err := tracing.Setup(cfg.Tracing, serviceName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				log.Errorf("Failed to shutdown tracing: %v", err)
+			}
+		}()
+
 		sigs := make(chan os.Signal, 1)
 		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-		repo := repository.NewInMemoryRepo()
-		mTLSCfg, err := createMTLSCfg(cfg)
+		repo, closeRepo, err := createItemsRepo(cfg.Storage)
+		if err != nil {
+			return err
+		}
+		defer closeRepo()
+		events := watch.NewHub(cfg.Watch)
+		tlsCfg, certWatcher, err := createTLSCfg(cfg)
 		if err != nil {
 			return err
 		}
+		defer certWatcher.Stop()
+		token, err := createTokenVerifier(cfg.Server.Grpc)
+		if err != nil {
+			return err
+		}
+
+		// the ops server is shut down last so it reports the gRPC server is not ready while the gRPC server drains
+		opsServer := server.NewOps(cfg.Server.Ops, log)
+		// GET returns and PUT level=debug changes the log level until the next config file change
+		opsServer.Handle("/loglevel", logLevel)
+		go func() {
+			if err := opsServer.ListenAndServe(); err != nil {
+				log.Panicf("Failed to listen or serve ops: %v", err)
+			}
+		}()
+		defer opsServer.GracefulShutdown()
 
-		grpcServer := createGrpcServer(cfg.Server.Grpc, mTLSCfg, repo)
+		grpcServer, gateway, err := createGrpcServer(cfg, tlsCfg, certWatcher, token, repo, events)
+		if err != nil {
+			return err
+		}
+		opsServer.Handle("/healthz", grpcServer.Health().LivenessHandler())
+		opsServer.Handle("/readyz", grpcServer.Health().ReadinessHandler())
 		go func() {
 			if err := grpcServer.ListenAndServe(); err != nil {
 				log.Panicf("Failed to listen or serve: %v", err)
 			}
 		}()
 		defer grpcServer.GracefulShutdown()
+		if gateway != nil {
+			go func() {
+				if err := gateway.ListenAndServe(); err != nil {
+					log.Panicf("Failed to listen or serve REST gateway: %v", err)
+				}
+			}()
+		}
+		if err := config.Watch(cfgFile, log, func(c config.Configuration) {
+			grpcServer.UpdateAuthz(c.Server.Grpc.Authz)
+			if err := logging.SetLevel(logLevel, c.Log.Level); err != nil {
+				log.Errorf("Failed to change log level: %v", err)
+			}
+		}); err != nil {
+			return err
+		}
 
 		// Block until we receive the signal.
 		<-sigs
@@ -66,52 +133,141 @@ var rootCmd = &cobra.Command{
 	},
 }
 
-func createMTLSCfg(cfg config.Configuration) (*tls.Config, error) {
-	srvTlsCfg, err := createSrvTlsCfg(cfg)
-	if err != nil {
-		return nil, err
+// createItemsRepo creates the items repository of the configured backend and the function closing it.
+func createItemsRepo(cfg repository.Config) (service.ItemsRepo, func(), error) {
+	switch cfg.Backend {
+	case repository.MemoryBackend:
+		if cfg.Memory.Dir == "" {
+			return repository.NewInMemoryRepo(), func() {}, nil
+		}
+		log.Infof("Restoring in memory items repository from '%s'.", cfg.Memory.Dir)
+		r, err := repository.OpenInMemoryRepo(cfg.Memory, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() {
+			if err := r.Close(); err != nil {
+				log.Errorf("Failed to close in memory items repository: %v", err)
+			}
+		}, nil
+	case repository.BoltBackend:
+		log.Infof("Opening bolt items repository '%s'.", cfg.Bolt.Path)
+		r, err := repository.NewBoltRepo(cfg.Bolt)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() {
+			if err := r.Close(); err != nil {
+				log.Errorf("Failed to close bolt items repository: %v", err)
+			}
+		}, nil
+	case repository.SQLBackend:
+		log.Infof("Connecting to '%s' items repository.", cfg.SQL.Driver)
+		r, err := repository.NewSQLRepo(cfg.SQL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, func() {
+			if err := r.Close(); err != nil {
+				log.Errorf("Failed to close sql items repository: %v", err)
+			}
+		}, nil
 	}
+	return nil, nil, errors.Errorf("unknown storage backend '%s'", cfg.Backend)
+}
 
-	cp, err := loadClientCACerts(cfg)
+// createTLSCfg creates the TLS config of the client authentication mode with the server certificate and client CAs
+// reloaded on change by the returned watcher.
+func createTLSCfg(cfg config.Configuration) (*tls.Config, *cert.Watcher, error) {
+	w, err := watchCerts(cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	tlsCfg := srvTlsCfg
-	// this forces mTLS - client has to provide its certificate
-	tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
-	tlsCfg.ClientCAs = cp
-	return tlsCfg, nil
+	tlsCfg := w.TLSConfig()
+	switch cfg.Server.Grpc.ClientAuth {
+	case server.ClientAuthMTLS:
+		// the client certificate is required by the authentication of the calls so the health probes without it
+		// can connect
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case server.ClientAuthMTLSOrJWT:
+		// client without certificate has to provide the bearer token
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case server.ClientAuthJWT:
+		tlsCfg.ClientAuth = tls.NoClientCert
+	default:
+		w.Stop()
+		return nil, nil, errors.Errorf("unknown client auth mode '%s'", cfg.Server.Grpc.ClientAuth)
+	}
+	return tlsCfg, w, nil
 }
 
-func createSrvTlsCfg(cfg config.Configuration) (*tls.Config, error) {
-	srvKP, err := tls.LoadX509KeyPair(cfg.Server.Grpc.CertFilename, cfg.Server.Grpc.KeyFilename)
-	if err != nil {
-		return nil, err
+func watchCerts(cfg config.Configuration) (*cert.Watcher, error) {
+	w := &cert.Watcher{
+		CertFile: cfg.Server.Grpc.CertFilename,
+		KeyFile:  cfg.Server.Grpc.KeyFilename,
+		Log:      log,
 	}
-	log.Infof("certificate and key loaded")
-	return &tls.Config{Certificates: []tls.Certificate{srvKP}}, nil
+	if cfg.Server.Grpc.ClientAuth != server.ClientAuthJWT {
+		if cfg.Server.Grpc.ClientCACert == "" {
+			return nil, errors.New("client CA certificate not set")
+		}
+		w.ClientCAFile = cfg.Server.Grpc.ClientCACert
+		w.CRLFiles = cfg.Server.Grpc.ClientCRLs
+	}
+	log.Infof("Watching certificate '%s', key '%s', CA certificate '%s' and CRLs %v for gRPC.",
+		w.CertFile, w.KeyFile, w.ClientCAFile, w.CRLFiles)
+	if err := w.Watch(); err != nil {
+		return nil, errors.Wrap(err, "certificates watch")
+	}
+	return w, nil
 }
 
-func loadClientCACerts(cfg config.Configuration) (*x509.CertPool, error) {
-	log.Infof("Loading CA certificate for gRPC from path '%v'.", cfg.Server.Grpc.ClientCACert)
-	b, err := ioutil.ReadFile(cfg.Server.Grpc.ClientCACert)
-	if err != nil {
-		return nil, errors.Wrap(err, "client CA certificate read")
+// createTokenVerifier creates the bearer token verifier when the client authentication mode accepts tokens.
+func createTokenVerifier(cfg server.Config) (*server.TokenVerifier, error) {
+	if cfg.ClientAuth == server.ClientAuthMTLS {
+		return nil, nil
 	}
-	cp := x509.NewCertPool()
-	if !cp.AppendCertsFromPEM(b) {
-		return nil, errors.New("failed to append client CA certificate")
+	log.Infof("Loading JWKS for gRPC from path '%s'.", cfg.JWT.JWKSFile)
+	v, err := server.NewTokenVerifier(cfg.JWT)
+	if err != nil {
+		return nil, errors.Wrap(err, "bearer token verifier")
 	}
+	return v, nil
+}
 
-	return cp, nil
+// pinger is the items repository able to check the storage is reachable.
+type pinger interface {
+	Ping(ctx context.Context) error
 }
 
-func createGrpcServer(opts server.Config, tls *tls.Config, r *repository.InMemoryRepo) *server.ShopServer {
-	server := server.New(opts, tls)
+// createGrpcServer creates the gRPC server with the shop services and the REST gateway to it when enabled.
+func createGrpcServer(cfg config.Configuration, tls *tls.Config, certs *cert.Watcher, token *server.TokenVerifier,
+	r service.ItemsRepo, events *watch.Hub) (*server.ShopServer, *server.Gateway, error) {
+	grpcServer, err := server.New(cfg.Server.Grpc, tls, token, log.Desugar())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create gRPC server")
+	}
+	grpcServer.Health().AddCheck("certificates", func(context.Context) error { return certs.Check() })
+	if p, ok := r.(pinger); ok {
+		grpcServer.Health().AddCheck("repository", p.Ping)
+	}
 
-	service := service.ShopService{ItemsRepo: r}
-	service.Register(server)
+	shop := &service.Shop{ItemsRepo: service.NewTracedItemsRepo(r), Events: events}
+	v1 := service.ShopService{Shop: shop, Currency: cfg.Service.V1Currency}
+	v1.Register(grpcServer)
+	v2 := service.ShopServiceV2{Shop: shop}
+	v2.Register(grpcServer)
 
-	return server
+	if !cfg.Server.Gateway.Enabled {
+		return grpcServer, nil, nil
+	}
+	gateway, err := server.NewGateway(cfg.Server.Gateway, tls, grpcServer, log)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create REST gateway")
+	}
+	if err := v1.RegisterGateway(gateway); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to register REST gateway handlers")
+	}
+	return grpcServer, gateway, nil
 }
@@ -0,0 +1,113 @@
+package cert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var revokedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "cert_watcher_revoked_client_certificates_total",
+	Help: "Total number of TLS handshakes rejected because of a revoked client certificate.",
+})
+
+// revocationList holds the revoked certificate serial numbers by the raw subject of their issuer.
+type revocationList map[string]map[string]struct{}
+
+// isRevoked returns whether the certificate is revoked by its issuer.
+func (l revocationList) isRevoked(c *x509.Certificate) bool {
+	_, revoked := l[string(c.RawIssuer)][c.SerialNumber.String()]
+	return revoked
+}
+
+// parseCRLs parses the PEM or DER encoded CRL files. Every CRL has to be signed by one of the CAs.
+func parseCRLs(files []string, cas []*x509.Certificate, log *zap.SugaredLogger) (revocationList, error) {
+	l := make(revocationList)
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		//nolint:staticcheck // x509.ParseRevocationList requires go 1.19
+		crl, err := x509.ParseCRL(b)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse CRL '%s': %w", f, err)
+		}
+		issuer := crlIssuer(crl, cas)
+		if issuer == nil {
+			return nil, fmt.Errorf("CRL '%s' is not signed by any client CA", f)
+		}
+		if crl.HasExpired(time.Now()) {
+			log.Errorf("CRL '%s' is outdated since %v, it is used until updated", f, crl.TBSCertList.NextUpdate)
+		}
+
+		serials, ok := l[string(issuer.RawSubject)]
+		if !ok {
+			serials = make(map[string]struct{})
+			l[string(issuer.RawSubject)] = serials
+		}
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			serials[rc.SerialNumber.String()] = struct{}{}
+		}
+	}
+	return l, nil
+}
+
+// crlIssuer returns the CA which signed the CRL.
+//
+//nolint:staticcheck // x509.RevocationList requires go 1.19
+func crlIssuer(crl *pkix.CertificateList, cas []*x509.Certificate) *x509.Certificate {
+	for _, ca := range cas {
+		if ca.CheckCRLSignature(crl) == nil {
+			return ca
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) loadCRLs() error {
+	w.mu.RLock()
+	cas := w.clientCACerts
+	w.mu.RUnlock()
+
+	l, err := parseCRLs(w.CRLFiles, cas, w.Log)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, serials := range l {
+		n += len(serials)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.revoked = l
+	w.Log.Infof("%d CRLs with %d revoked certificates loaded", len(w.CRLFiles), n)
+	return nil
+}
+
+func (w *Watcher) getRevoked() revocationList {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.revoked
+}
+
+// verifyNotRevoked rejects the client certificate chains containing a revoked certificate.
+func (w *Watcher) verifyNotRevoked(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	revoked := w.getRevoked()
+	for _, chain := range verifiedChains {
+		for _, c := range chain {
+			if revoked.isRevoked(c) {
+				w.Log.Infof("rejected revoked client certificate, subject '%s', serial number '%s'", c.Subject, c.SerialNumber)
+				revokedTotal.Inc()
+				return fmt.Errorf("certificate with serial number '%s' is revoked", c.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWatcher_verifyNotRevoked(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createCA(t, "client-ca")
+	otherCA, otherCAKey := createCA(t, "other-ca")
+	crlFile := createCRLFile(t, dir, "client-ca.crl", ca, caKey, 2)
+	otherCRLFile := createCRLFile(t, dir, "other-ca.crl", otherCA, otherCAKey, 3)
+
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		wantErr bool
+	}{
+		{
+			name:  "certificate not revoked",
+			chain: []*x509.Certificate{createClientCert(t, ca, caKey, 3), ca},
+		},
+		{
+			name:    "certificate revoked",
+			chain:   []*x509.Certificate{createClientCert(t, ca, caKey, 2), ca},
+			wantErr: true,
+		},
+		{
+			name:  "certificate of other CA with revoked serial",
+			chain: []*x509.Certificate{createClientCert(t, otherCA, otherCAKey, 2), otherCA},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			w := &Watcher{
+				CRLFiles:      []string{crlFile, otherCRLFile},
+				clientCACerts: []*x509.Certificate{ca, otherCA},
+				Log:           zaptest.NewLogger(t).Sugar(),
+			}
+			r.NoError(w.loadCRLs())
+
+			err := w.verifyNotRevoked(nil, [][]*x509.Certificate{tt.chain})
+
+			r.Equal(tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestParseCRLs(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := createCA(t, "client-ca")
+	otherCA, otherCAKey := createCA(t, "other-ca")
+	crlFile := createCRLFile(t, dir, "client-ca.crl", ca, caKey, 2, 3)
+	otherCRLFile := createCRLFile(t, dir, "other-ca.crl", otherCA, otherCAKey, 4)
+
+	tests := []struct {
+		name        string
+		files       []string
+		wantRevoked int
+		wantErr     bool
+	}{
+		{
+			name:        "valid CRL",
+			files:       []string{crlFile},
+			wantRevoked: 2,
+		},
+		{
+			name:    "CRL not signed by client CA",
+			files:   []string{crlFile, otherCRLFile},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CRL",
+			files:   []string{invalidCertFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing CRL",
+			files:   []string{filepath.Join(dir, "missing.crl")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := parseCRLs(tt.files, []*x509.Certificate{ca}, zaptest.NewLogger(t).Sugar())
+
+			require.Equal(t, tt.wantErr, err != nil)
+			require.Len(t, l[string(ca.RawSubject)], tt.wantRevoked)
+		})
+	}
+}
+
+func createCA(t *testing.T, name string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return ca, key
+}
+
+func createClientCert(t *testing.T, ca *x509.Certificate, caKey *rsa.PrivateKey, serial int64) *x509.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	c, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return c
+}
+
+func createCRLFile(t *testing.T, dir, name string, ca *x509.Certificate, caKey *rsa.PrivateKey, serials ...int64) string {
+	var revoked []pkix.RevokedCertificate
+	for _, s := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now(),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: revoked,
+	}, ca, caKey)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+	return file
+}
@@ -1,74 +1,231 @@
 package cert
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
 )
 
+const defaultDebounce = 100 * time.Millisecond
+
+// kinds of the watched files, reloaded together
+const (
+	keyPairKind  = "key_pair"
+	clientCAKind = "client_ca"
+	crlKind      = "crl"
+)
+
+var reloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cert_watcher_reloads_total",
+	Help: "Total number of reloads after a change of the watched files by the reloaded file and result.",
+}, []string{"file", "result"})
+
 // Watcher represents a certificate manager able to watch certificate and key pairs for changes.
 type Watcher struct {
 	mu       sync.RWMutex
 	CertFile string
 	KeyFile  string
-	keyPair  *tls.Certificate
-	watcher  *fsnotify.Watcher
-	stop     chan struct{}
-	Log      Logger
-}
-
-// Logger is an interface that wraps the basic logger methods.
-type Logger interface {
-	Infof(string, ...interface{})
-	Debugf(string, ...interface{})
-	Errorf(string, ...interface{})
+	// ClientCAFile is the optional PEM bundle of the CA certificates verifying the client certificates.
+	ClientCAFile string
+	// CRLFiles are the optional PEM or DER encoded CRLs of the client CAs, the revoked client certificates are rejected.
+	CRLFiles []string
+	// Debounce is the delay of the reload after the last change of the files, defaults to 100ms.
+	Debounce  time.Duration
+	keyPair   *tls.Certificate
+	clientCAs *x509.CertPool
+	// clientCACerts are the certificates of the client CAs verifying the CRL signatures.
+	clientCACerts []*x509.Certificate
+	revoked       revocationList
+	// targets are the resolved symlink targets of the files, used only by the watching goroutine.
+	targets map[string]string
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	Log     *zap.SugaredLogger
 }
 
-// Watch starts watching for changes to the certificate and key files. On any change the certificate and key
-// are reloaded. If there is an issue the load will fail and the old certificate and key will continue to be served.
+// Watch starts watching for changes to the certificate, key, client CA and CRL files. The parent directories of the files
+// and of their symlink targets are watched so atomic replacements, such as the swap of the '..data' symlink of
+// Kubernetes secret volumes, are noticed. Bursts of changes are debounced and the changed files are reloaded
+// afterwards. If there is an issue, e.g. the certificate doesn't match the key yet, the load will fail and the old
+// certificate, key, client CAs and CRLs will continue to be used.
 func (w *Watcher) Watch() error {
 	var err error
 	if w.watcher, err = fsnotify.NewWatcher(); err != nil {
 		return fmt.Errorf("can't create watcher: %w", err)
 	}
-	if err = w.watcher.Add(w.CertFile); err != nil {
-		return fmt.Errorf("can't watch cert file: %w", err)
-	}
-	if err = w.watcher.Add(w.KeyFile); err != nil {
-		return fmt.Errorf("can't watch key file: %w", err)
+	if err := w.watchDirs(); err != nil {
+		_ = w.watcher.Close()
+		return err
 	}
 	if err := w.load(); err != nil {
+		_ = w.watcher.Close()
 		return fmt.Errorf("can't load cert or key file: %w", err)
 	}
+	if w.ClientCAFile != "" {
+		if err := w.loadClientCAs(); err != nil {
+			_ = w.watcher.Close()
+			return fmt.Errorf("can't load client CA file: %w", err)
+		}
+	}
+	if len(w.CRLFiles) > 0 {
+		if w.ClientCAFile == "" {
+			_ = w.watcher.Close()
+			return errors.New("CRL files require client CA file")
+		}
+		if err := w.loadCRLs(); err != nil {
+			_ = w.watcher.Close()
+			return fmt.Errorf("can't load CRL files: %w", err)
+		}
+	}
 	w.stop = make(chan struct{})
 	go w.run()
 	return nil
 }
 
+// files returns the watched files.
+func (w *Watcher) files() []string {
+	files := []string{w.CertFile, w.KeyFile}
+	if w.ClientCAFile != "" {
+		files = append(files, w.ClientCAFile)
+	}
+	return append(files, w.CRLFiles...)
+}
+
+// kind returns the kind of the watched file.
+func (w *Watcher) kind(file string) string {
+	switch file {
+	case w.CertFile, w.KeyFile:
+		return keyPairKind
+	case w.ClientCAFile:
+		return clientCAKind
+	}
+	return crlKind
+}
+
+// watchDirs watches the parent directories of the files and of their resolved symlink targets.
+func (w *Watcher) watchDirs() error {
+	targets := make(map[string]string)
+	for _, f := range w.files() {
+		if err := w.watcher.Add(filepath.Dir(f)); err != nil {
+			return fmt.Errorf("can't watch directory of '%s': %w", f, err)
+		}
+		target, err := filepath.EvalSymlinks(f)
+		if err != nil {
+			// the file may not exist yet, it will be resolved again on the next change
+			continue
+		}
+		if err := w.watcher.Add(filepath.Dir(target)); err != nil {
+			return fmt.Errorf("can't watch directory of '%s': %w", target, err)
+		}
+		targets[f] = target
+	}
+	w.targets = targets
+	return nil
+}
+
+// changedFiles returns the watched files affected by the change of the path.
+func (w *Watcher) changedFiles(path string) []string {
+	var changed []string
+	for _, f := range w.files() {
+		switch {
+		case path == filepath.Clean(f), path == w.targets[f]:
+			changed = append(changed, f)
+		case filepath.Dir(path) == filepath.Dir(filepath.Clean(f)) && strings.HasPrefix(filepath.Base(path), ".."):
+			// Kubernetes atomic writer swaps the '..data' symlink pointing to the timestamped '..' directory
+			changed = append(changed, f)
+		}
+	}
+	return changed
+}
+
+func (w *Watcher) debounce() time.Duration {
+	if w.Debounce > 0 {
+		return w.Debounce
+	}
+	return defaultDebounce
+}
+
 func (w *Watcher) load() error {
 	keyPair, err := tls.LoadX509KeyPair(w.CertFile, w.KeyFile)
 	if err != nil {
 		return err
 	}
+	if keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0]); err != nil {
+		return err
+	}
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	w.keyPair = &keyPair
-	w.Log.Infof("certificate and key loaded")
+	w.Log.Infof("certificate and key loaded, subject '%s', serial number '%s', expires at %v",
+		keyPair.Leaf.Subject, keyPair.Leaf.SerialNumber, keyPair.Leaf.NotAfter)
 	return nil
 }
 
-func (w *Watcher) respawnFile(filepath string) error {
-	respawned, err := os.Create(filepath)
+func (w *Watcher) loadClientCAs() error {
+	b, err := ioutil.ReadFile(w.ClientCAFile)
 	if err != nil {
 		return err
 	}
-	return respawned.Close()
+	pool, certs, err := parseCertPool(b)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clientCAs = pool
+	w.clientCACerts = certs
+	w.Log.Infof("%d client CA certificates loaded", len(certs))
+	return nil
+}
+
+// parseCertPool parses the PEM bundle of certificates, unlike x509.CertPool.AppendCertsFromPEM it fails
+// on any invalid certificate so a partially written bundle is never used.
+func parseCertPool(b []byte) (*x509.CertPool, []*x509.Certificate, error) {
+	pool := x509.NewCertPool()
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			if len(bytes.TrimSpace(b)) > 0 {
+				return nil, nil, errors.New("invalid PEM data")
+			}
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, nil, fmt.Errorf("unexpected PEM block type '%s'", block.Type)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool.AddCert(c)
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, nil, errors.New("no certificate found")
+	}
+	return pool, certs, nil
 }
 
 func (w *Watcher) run() {
+	timer := time.NewTimer(w.debounce())
+	timer.Stop()
+	defer timer.Stop()
+	pending := make(map[string]bool)
 	for {
 		select {
 		case <-w.stop:
@@ -77,37 +234,129 @@ func (w *Watcher) run() {
 			return
 		case event := <-w.watcher.Events:
 			w.Log.Debugf("watch event: %v", event)
-			if event.Op == fsnotify.Remove {
-				if err := w.respawnFile(event.Name); err != nil {
-					w.Log.Debugf("can't re-spawn file: %v", err)
-				}
-				if err := w.watcher.Add(event.Name); err != nil {
-					w.Log.Debugf("can't re-add watch: %v", err)
-				}
+			changed := w.changedFiles(event.Name)
+			for _, f := range changed {
+				pending[w.kind(f)] = true
+			}
+			if len(changed) > 0 {
+				timer.Reset(w.debounce())
+			}
+		case <-timer.C:
+			if err := w.watchDirs(); err != nil {
+				w.Log.Debugf("can't re-add watch: %v", err)
+			}
+			if pending[clientCAKind] && len(w.CRLFiles) > 0 {
+				// CRL signatures are verified by the client CAs
+				pending[crlKind] = true
 			}
-			if err := w.load(); err != nil {
-				w.Log.Errorf("can't load cert or key file: %v", err)
+			// client CAs are reloaded before the CRLs verified by them
+			for _, kind := range []string{keyPairKind, clientCAKind, crlKind} {
+				if pending[kind] {
+					w.reload(kind)
+				}
 			}
+			pending = make(map[string]bool)
 		case err := <-w.watcher.Errors:
 			w.Log.Debugf("error watching files: %v", err)
 		}
 	}
 }
 
-// Stop tells Watcher to stop watching for changes to the certificate and key files.
+// reload reloads the files of the kind.
+func (w *Watcher) reload(kind string) {
+	var err error
+	switch kind {
+	case keyPairKind:
+		err = w.load()
+	case clientCAKind:
+		err = w.loadClientCAs()
+	case crlKind:
+		err = w.loadCRLs()
+	}
+	if err != nil {
+		w.Log.Errorf("can't load %s files: %v", kind, err)
+		reloadsTotal.WithLabelValues(kind, "failure").Inc()
+		return
+	}
+	reloadsTotal.WithLabelValues(kind, "success").Inc()
+}
+
+// Stop tells Watcher to stop watching for changes to the certificate, key, client CA and CRL files.
 func (w *Watcher) Stop() {
 	w.stop <- struct{}{}
 }
 
+// Check returns error when the certificate is not valid at the moment or the client CAs are not loaded.
+func (w *Watcher) Check() error {
+	keyPair := w.getCertificate()
+	if keyPair == nil {
+		return errors.New("certificate not loaded")
+	}
+	now := time.Now()
+	if now.After(keyPair.Leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %v", keyPair.Leaf.NotAfter)
+	}
+	if now.Before(keyPair.Leaf.NotBefore) {
+		return fmt.Errorf("certificate not valid before %v", keyPair.Leaf.NotBefore)
+	}
+	if w.ClientCAFile != "" && w.getClientCAs() == nil {
+		return errors.New("client CA certificates not loaded")
+	}
+	return nil
+}
+
 func (w *Watcher) getCertificate() *tls.Certificate {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 	return w.keyPair
 }
 
+func (w *Watcher) getClientCAs() *x509.CertPool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.clientCAs
+}
+
 // TLSConfig creates a new dynamically loaded tls.Config, in which changes to the certificate are reflected in.
+// When the client CA file is watched, every handshake verifies the client certificate by the latest client CAs
+// and rejects it when revoked by the latest CRLs. The per-handshake config doesn't see the ALPN protocols added
+// by the listeners to their copies of the config, they have to be set by WithNextProtos.
 func (w *Watcher) TLSConfig() *tls.Config {
-	return &tls.Config{GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cfg := &tls.Config{GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
 		return w.getCertificate(), nil
 	}}
+	if w.ClientCAFile == "" {
+		return cfg
+	}
+	if len(w.CRLFiles) > 0 {
+		cfg.VerifyPeerCertificate = w.verifyNotRevoked
+	}
+	cfg.ClientCAs = w.getClientCAs()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		// the config is cloned per handshake so the settings changed after TLSConfig call are kept
+		c := cfg.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = w.getClientCAs()
+		return c, nil
+	}
+	return cfg
+}
+
+// WithNextProtos returns the copy of the config advertising the ALPN protocols, also by the per-handshake configs
+// returned by its GetConfigForClient.
+func WithNextProtos(cfg *tls.Config, protos ...string) *tls.Config {
+	c := cfg.Clone()
+	c.NextProtos = protos
+	if getConfig := cfg.GetConfigForClient; getConfig != nil {
+		c.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			hc, err := getConfig(hello)
+			if err != nil || hc == nil {
+				return hc, err
+			}
+			hc = hc.Clone()
+			hc.NextProtos = protos
+			return hc, nil
+		}
+	}
+	return c
 }
@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 )
@@ -75,6 +77,147 @@ func TestWatcher_TLSConfig(t *testing.T) {
 	validateCert(validTLSConf2)
 }
 
+func TestWatcher_KubernetesSecretVolume(t *testing.T) {
+	dir := t.TempDir()
+	testCertFile := filepath.Join(dir, "tls.crt")
+	testKeyFile := filepath.Join(dir, "tls.key")
+
+	// writeSecret imitates the Kubernetes atomic writer swapping the '..data' symlink to the new timestamped directory
+	writeSecret := func(ts string) *tls.Config {
+		tsDir := filepath.Join(dir, ts)
+		require.NoError(t, os.Mkdir(tsDir, 0o700))
+		keyFile, certFile, tlsConf := createValidTLSPairInDir(tsDir, "tls")
+		require.NoError(t, os.Symlink(ts, filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+		_ = os.Symlink(filepath.Join("..data", filepath.Base(certFile)), testCertFile)
+		_ = os.Symlink(filepath.Join("..data", filepath.Base(keyFile)), testKeyFile)
+		return tlsConf
+	}
+
+	r := require.New(t)
+	w := &Watcher{
+		CertFile: testCertFile,
+		KeyFile:  testKeyFile,
+		Log:      zaptest.NewLogger(t).Sugar(),
+	}
+
+	validateCert := func(tlsConf *tls.Config) {
+		time.Sleep(500 * time.Millisecond)
+		cert, err := w.TLSConfig().GetCertificate(nil)
+		r.NoError(err)
+		r.Equal(tlsConf.Certificates[0].Certificate, cert.Certificate)
+	}
+
+	t.Log("watch initial secret")
+	tlsConf := writeSecret("..2022_01_01_00_00_00.1")
+	r.NoError(w.Watch())
+	defer w.Stop()
+	validateCert(tlsConf)
+
+	t.Log("swap secret and remove the old data")
+	tlsConf2 := writeSecret("..2022_01_02_00_00_00.2")
+	r.NoError(os.RemoveAll(filepath.Join(dir, "..2022_01_01_00_00_00.1")))
+	validateCert(tlsConf2)
+
+	t.Log("watched paths are not modified")
+	target, err := os.Readlink(testCertFile)
+	r.NoError(err)
+	r.Equal(filepath.Join("..data", "tls.crt"), target)
+}
+
+func TestWatcher_ClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	testCAFile := filepath.Join(dir, "ca.crt")
+	keyFile, certFile, _ := createValidTLSPairInDir(dir, "server")
+
+	r := require.New(t)
+	w := &Watcher{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: testCAFile,
+		Log:          zaptest.NewLogger(t).Sugar(),
+	}
+
+	validateClientCAs := func(caFile string) {
+		time.Sleep(500 * time.Millisecond)
+		b, err := os.ReadFile(caFile)
+		r.NoError(err)
+		want, _, err := parseCertPool(b)
+		r.NoError(err)
+		tlsConf, err := w.TLSConfig().GetConfigForClient(nil)
+		r.NoError(err)
+		//nolint:staticcheck // pools are compared by the subjects of their certificates
+		r.Equal(want.Subjects(), tlsConf.ClientCAs.Subjects())
+	}
+
+	t.Log("watch missing client CA file should fail")
+	r.Error(w.Watch())
+
+	t.Log("watch valid client CA")
+	_, validCAFile, _ := createValidTLSPairInDir(t.TempDir(), "ca")
+	mustCopyFile(validCAFile, testCAFile)
+	r.NoError(w.Watch())
+	defer w.Stop()
+	validateClientCAs(validCAFile)
+
+	t.Log("replace with invalid client CA")
+	mustCopyFile(invalidCertFile, testCAFile)
+	validateClientCAs(validCAFile)
+
+	t.Log("replace with bundle of client CAs")
+	bundleDir := t.TempDir()
+	_, validCAFile2, _ := createValidTLSPairInDir(bundleDir, "ca")
+	bundle, err := os.ReadFile(validCAFile2)
+	r.NoError(err)
+	bundleFile := filepath.Join(bundleDir, "bundle.crt")
+	r.NoError(os.WriteFile(bundleFile, append(bundle, bundle...), 0o600))
+	mustCopyFile(bundleFile, testCAFile)
+	validateClientCAs(bundleFile)
+}
+
+func TestParseCertPool(t *testing.T) {
+	_, validCertFile, _ := createValidTLSPairInDir(t.TempDir(), "valid")
+	valid, err := os.ReadFile(validCertFile)
+	require.NoError(t, err)
+	invalid, err := os.ReadFile(invalidCertFile)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantN   int
+		wantErr bool
+	}{
+		{
+			name:  "single certificate",
+			pem:   valid,
+			wantN: 1,
+		},
+		{
+			name:  "bundle of certificates",
+			pem:   append(append([]byte{}, valid...), valid...),
+			wantN: 2,
+		},
+		{
+			name:    "empty bundle",
+			wantErr: true,
+		},
+		{
+			name:    "bundle with invalid certificate",
+			pem:     append(append([]byte{}, valid...), invalid...),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, certs, err := parseCertPool(tt.pem)
+
+			require.Equal(t, tt.wantErr, err != nil)
+			require.Len(t, certs, tt.wantN)
+		})
+	}
+}
+
 func TestWatcher_load(t *testing.T) {
 	validKeyFile, validCertFile, _ := createValidTLSPairInDir(t.TempDir(), "valid")
 	type fields struct {
@@ -190,3 +333,86 @@ func tlsConfigFromFile(keyFile, certFile string) *tls.Config {
 	}
 	return &tls.Config{Certificates: []tls.Certificate{cert}}
 }
+
+func TestWatcher_Check(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		keyPair      *tls.Certificate
+		clientCAFile string
+		clientCAs    *x509.CertPool
+		wantErr      bool
+	}{
+		{
+			name:    "valid certificate",
+			keyPair: &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}},
+		},
+		{
+			name:    "certificate not loaded",
+			wantErr: true,
+		},
+		{
+			name:    "expired certificate",
+			keyPair: &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(-time.Hour)}},
+			wantErr: true,
+		},
+		{
+			name:    "certificate not valid yet",
+			keyPair: &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now.Add(time.Hour), NotAfter: now.Add(2 * time.Hour)}},
+			wantErr: true,
+		},
+		{
+			name:         "client CAs loaded",
+			keyPair:      &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}},
+			clientCAFile: "ca.crt",
+			clientCAs:    x509.NewCertPool(),
+		},
+		{
+			name:         "client CAs not loaded",
+			keyPair:      &tls.Certificate{Leaf: &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}},
+			clientCAFile: "ca.crt",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{ClientCAFile: tt.clientCAFile, keyPair: tt.keyPair, clientCAs: tt.clientCAs}
+
+			err := w.Check()
+
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestWithNextProtos(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, certFile, _ := createValidTLSPairInDir(dir, "server")
+	_, caFile, _ := createValidTLSPairInDir(dir, "ca")
+	w := &Watcher{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, Log: zaptest.NewLogger(t).Sugar()}
+	require.NoError(t, w.Watch())
+	defer w.Stop()
+
+	tests := []struct {
+		name        string
+		clientProto []string
+		want        string
+	}{
+		{name: "preferred protocol", clientProto: []string{"h2", "http/1.1"}, want: "h2"},
+		{name: "fallback protocol", clientProto: []string{"http/1.1"}, want: "http/1.1"},
+		{name: "no protocol", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer serverConn.Close()
+			defer clientConn.Close()
+			server := tls.Server(serverConn, WithNextProtos(w.TLSConfig(), "h2", "http/1.1"))
+			go server.Handshake() //nolint:errcheck
+			client := tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true, NextProtos: tt.clientProto})
+
+			require.NoError(t, client.Handshake())
+			assert.Equal(t, tt.want, client.ConnectionState().NegotiatedProtocol)
+		})
+	}
+}
@@ -1,13 +1,27 @@
 package config
 
-import "github.com/plieskovsky/go-grpc-server-shop/internal/server"
+import (
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/server"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/service"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/tracing"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
+)
 
 // Configuration structure.
 type Configuration struct {
-	Server Servers
+	Server  Servers
+	Service service.Config
+	Storage repository.Config
+	Watch   watch.Config
+	Log     logging.Config
+	Tracing tracing.Config
 }
 
 // Servers configuration structure.
 type Servers struct {
-	Grpc server.Config
+	Grpc    server.Config
+	Ops     server.OpsConfig
+	Gateway server.GatewayConfig
 }
@@ -1,14 +1,28 @@
 package config
 
 import (
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/server"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/service"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/tracing"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
 	"os"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
-var defaultCfg = Configuration{Server: Servers{Grpc: server.DefaultConfig}}
+var defaultCfg = Configuration{
+	Server:  Servers{Grpc: server.DefaultConfig, Ops: server.DefaultOpsConfig, Gateway: server.DefaultGatewayConfig},
+	Service: service.DefaultConfig,
+	Storage: repository.DefaultConfig,
+	Watch:   watch.DefaultConfig,
+	Log:     logging.DefaultConfig,
+	Tracing: tracing.DefaultConfig,
+}
 
 // MustParse must parse and validate viper config.
 func MustParse(cfgFile string) Configuration {
@@ -21,32 +35,60 @@ func MustParse(cfgFile string) Configuration {
 
 // Parse parses and validates viper config.
 func Parse(cfgFile string) (Configuration, error) {
-	viper.SetConfigFile(cfgFile)
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	return parse(v)
+}
+
+// Watch calls the onChange function with the configuration parsed on every change of the config file.
+// Invalid configuration is logged to the logger and ignored.
+func Watch(cfgFile string, log *zap.SugaredLogger, onChange func(Configuration)) error {
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	if err := v.ReadInConfig(); err != nil {
+		return errors.Wrap(err, "failed to read configuration")
+	}
+	v.OnConfigChange(func(e fsnotify.Event) {
+		// a new instance is parsed so the values expanded from the previous file version are not kept
+		nv := viper.New()
+		nv.SetConfigFile(cfgFile)
+		cfg, err := parse(nv)
+		if err != nil {
+			log.Errorf("Failed to reload configuration '%s': %v", e.Name, err)
+			return
+		}
+		log.Infof("Configuration '%s' reloaded.", e.Name)
+		onChange(cfg)
+	})
+	v.WatchConfig()
+	return nil
+}
 
+func parse(v *viper.Viper) (Configuration, error) {
 	cfg := defaultCfg
 
 	// Load config from file
-	if err := viper.ReadInConfig(); err != nil {
+	if err := v.ReadInConfig(); err != nil {
 		return cfg, errors.Wrap(err, "failed to read configuration")
 	}
 
 	// Expand env variables to loaded config
-	expandEnvVariables()
+	expandEnvVariables(v)
 
 	// Deserialize config to struct
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return cfg, errors.Wrap(err, "failed to deserialize config")
 	}
 
 	return cfg, nil
 }
 
-func expandEnvVariables() {
+func expandEnvVariables(v *viper.Viper) {
 	// Need to expand in this way due to https://github.com/spf13/viper/issues/315
-	for _, k := range viper.AllKeys() {
-		switch value := viper.Get(k).(type) {
+	for _, k := range v.AllKeys() {
+		switch value := v.Get(k).(type) {
 		case string:
-			viper.Set(k, os.ExpandEnv(value))
+			v.Set(k, os.ExpandEnv(value))
 		}
 	}
 }
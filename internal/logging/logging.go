@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// log formats
+const (
+	JSONFormat    = "json"
+	ConsoleFormat = "console"
+)
+
+// Config of the logging.
+type Config struct {
+	// Level is the minimal level of the logged messages, it can be changed at runtime.
+	Level string
+	// Format is 'json' or 'console'.
+	Format string
+}
+
+// DefaultConfig default logging options.
+var DefaultConfig = Config{
+	Level:  "info",
+	Format: JSONFormat,
+}
+
+// New returns logger of the config writing to stderr and its level which can be changed at runtime.
+func New(cfg Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if err := SetLevel(level, cfg.Level); err != nil {
+		return nil, level, err
+	}
+
+	var zapCfg zap.Config
+	switch cfg.Format {
+	case JSONFormat:
+		zapCfg = zap.NewProductionConfig()
+	case ConsoleFormat:
+		zapCfg = zap.NewDevelopmentConfig()
+	default:
+		return nil, level, errors.Errorf("unknown log format '%s'", cfg.Format)
+	}
+	zapCfg.Level = level
+	zapCfg.Sampling = nil
+	zapCfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, level, errors.Wrap(err, "failed to build logger")
+	}
+	return logger, level, nil
+}
+
+// SetLevel sets the level by its name.
+func SetLevel(level zap.AtomicLevel, name string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return errors.Wrapf(err, "invalid log level '%s'", name)
+	}
+	level.SetLevel(l)
+	return nil
+}
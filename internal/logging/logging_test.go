@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		wantLevel zapcore.Level
+		wantErr   bool
+	}{
+		{
+			name:      "json format",
+			cfg:       Config{Level: "info", Format: JSONFormat},
+			wantLevel: zapcore.InfoLevel,
+		},
+		{
+			name:      "console format",
+			cfg:       Config{Level: "debug", Format: ConsoleFormat},
+			wantLevel: zapcore.DebugLevel,
+		},
+		{
+			name:    "unknown format",
+			cfg:     Config{Level: "info", Format: "xml"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown level",
+			cfg:     Config{Level: "verbose", Format: JSONFormat},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, level, err := New(tt.cfg)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.wantLevel, level.Level())
+				assert.True(t, logger.Core().Enabled(tt.wantLevel))
+				assert.False(t, logger.Core().Enabled(tt.wantLevel-1))
+			}
+		})
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	_, level, err := New(DefaultConfig)
+	assert.NoError(t, err)
+
+	assert.NoError(t, SetLevel(level, "warn"))
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+	assert.Error(t, SetLevel(level, "verbose"))
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+}
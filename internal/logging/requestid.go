@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"unicode"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/twinj/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata with the ID of the request.
+const RequestIDHeader = "x-request-id"
+
+// RequestIDField is the log field with the ID of the request.
+const RequestIDField = "request_id"
+
+// maxRequestIDLen limits the length of the request ID accepted from the clients.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// nopLogger is the logger of the contexts of no request.
+var nopLogger = zap.NewNop().Sugar()
+
+// NewContext returns context carrying the request ID and the logger of the request.
+func NewContext(ctx context.Context, requestID string, logger *zap.SugaredLogger) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return context.WithValue(ctx, loggerKey{}, logger.With(RequestIDField, requestID))
+}
+
+// RequestIDFromContext returns the request ID carried by the context.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// FromContext returns logger of the request carried by the context, the no-op logger when there is none.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return nopLogger
+}
+
+// UnaryServerInterceptor returns interceptor putting the request ID to the context, response header and the fields
+// of the gRPC call log. The ID is taken from the request metadata or generated. The context carries the logger
+// adding the request ID to every log line.
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withRequestID(ctx, logger), req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor putting the request ID to the stream context, response header
+// and the fields of the gRPC call log. The ID is taken from the request metadata or generated. The context carries
+// the logger adding the request ID to every log line.
+func StreamServerInterceptor(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = withRequestID(ss.Context(), logger)
+		return handler(srv, wrapped)
+	}
+}
+
+func withRequestID(ctx context.Context, logger *zap.Logger) context.Context {
+	id := incomingRequestID(ctx)
+	if id == "" {
+		id = uuid.NewV4().String()
+	}
+
+	ctx = NewContext(ctx, id, logger.Sugar())
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id)); err != nil {
+		FromContext(ctx).Debugf("Failed to set request ID header: %v", err)
+	}
+	ctxzap.AddFields(ctx, zap.String(RequestIDField, id))
+	return ctx
+}
+
+// incomingRequestID returns the valid request ID of the request metadata.
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(RequestIDHeader)
+	if len(ids) == 0 || !validRequestID(ids[0]) {
+		return ""
+	}
+	return ids[0]
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
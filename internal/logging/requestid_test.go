@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// transportStream records the header set by the interceptors.
+type transportStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID []string
+		want      string
+	}{
+		{
+			name:      "request ID from metadata",
+			requestID: []string{"req-1"},
+			want:      "req-1",
+		},
+		{
+			name: "generated request ID",
+		},
+		{
+			name:      "too long request ID",
+			requestID: []string{strings.Repeat("x", maxRequestIDLen+1)},
+		},
+		{
+			name:      "request ID with control characters",
+			requestID: []string{"req-1\nfake log line"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &transportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			if tt.requestID != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(RequestIDHeader, tt.requestID[0]))
+			}
+
+			core, logs := observer.New(zap.InfoLevel)
+			var got string
+			_, err := UnaryServerInterceptor(zap.New(core))(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				got, _ = RequestIDFromContext(ctx)
+				FromContext(ctx).Info("handled")
+				return nil, nil
+			})
+
+			assert.NoError(t, err)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, got)
+			} else {
+				assert.Len(t, got, 36)
+			}
+			assert.Equal(t, []string{got}, stream.header.Get(RequestIDHeader))
+			if assert.Equal(t, 1, logs.Len()) {
+				assert.Equal(t, got, logs.All()[0].ContextMap()[RequestIDField])
+			}
+		})
+	}
+}
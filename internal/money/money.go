@@ -0,0 +1,69 @@
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+)
+
+const nanosPerUnit = 1000000000
+
+// Validate checks that the currency code is known and the nanos are in range and have the same sign as the units.
+func Validate(m *shopv2.Money) error {
+	if m == nil {
+		return errors.New("money is not set")
+	}
+	if !IsCurrency(m.GetCurrencyCode()) {
+		return fmt.Errorf("unknown currency code '%s'", m.GetCurrencyCode())
+	}
+	if m.GetNanos() <= -nanosPerUnit || m.GetNanos() >= nanosPerUnit {
+		return fmt.Errorf("nanos '%d' out of range", m.GetNanos())
+	}
+	if (m.GetUnits() > 0 && m.GetNanos() < 0) || (m.GetUnits() < 0 && m.GetNanos() > 0) {
+		return errors.New("units and nanos must have the same sign")
+	}
+	return nil
+}
+
+// FromFloat converts the amount to money in the currency rounded to the minor unit of the currency.
+// The decimal representation of the amount is converted, so 100.15 is not turned into 100.15000152.
+func FromFloat(amount float32, currency string) (*shopv2.Money, error) {
+	digits, ok := currencies[currency]
+	if !ok {
+		return nil, fmt.Errorf("unknown currency code '%s'", currency)
+	}
+	if math.IsNaN(float64(amount)) || math.IsInf(float64(amount), 0) {
+		return nil, fmt.Errorf("amount '%v' is not a number", amount)
+	}
+
+	s := strconv.FormatFloat(float64(amount), 'f', digits, 32)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("amount '%v' out of range", amount)
+	}
+	nanos, err := strconv.ParseInt((fraction + "000000000")[:9], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	if negative {
+		units, nanos = -units, -nanos
+	}
+	return &shopv2.Money{CurrencyCode: currency, Units: units, Nanos: int32(nanos)}, nil
+}
+
+// ToFloat converts the money amount to the nearest float, the currency is dropped.
+func ToFloat(m *shopv2.Money) float32 {
+	return float32(float64(m.GetUnits()) + float64(m.GetNanos())/nanosPerUnit)
+}
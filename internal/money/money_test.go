@@ -0,0 +1,159 @@
+package money
+
+import (
+	"math"
+	"testing"
+
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       *shopv2.Money
+		wantErr bool
+	}{
+		{
+			name: "valid amount",
+			m:    &shopv2.Money{CurrencyCode: "EUR", Units: 100, Nanos: 150000000},
+		},
+		{
+			name: "valid negative amount",
+			m:    &shopv2.Money{CurrencyCode: "USD", Units: -1, Nanos: -750000000},
+		},
+		{
+			name: "valid negative amount without units",
+			m:    &shopv2.Money{CurrencyCode: "USD", Nanos: -750000000},
+		},
+		{
+			name:    "money not set",
+			wantErr: true,
+		},
+		{
+			name:    "unknown currency",
+			m:       &shopv2.Money{CurrencyCode: "XYZ", Units: 1},
+			wantErr: true,
+		},
+		{
+			name:    "lower case currency",
+			m:       &shopv2.Money{CurrencyCode: "eur", Units: 1},
+			wantErr: true,
+		},
+		{
+			name:    "nanos out of range",
+			m:       &shopv2.Money{CurrencyCode: "EUR", Units: 1, Nanos: 1000000000},
+			wantErr: true,
+		},
+		{
+			name:    "units and nanos with different sign",
+			m:       &shopv2.Money{CurrencyCode: "EUR", Units: 1, Nanos: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.m)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float32
+		currency string
+		want     *shopv2.Money
+		wantErr  bool
+	}{
+		{
+			name:     "amount not representable by float",
+			amount:   100.15,
+			currency: "EUR",
+			want:     &shopv2.Money{CurrencyCode: "EUR", Units: 100, Nanos: 150000000},
+		},
+		{
+			name:     "whole amount",
+			amount:   45,
+			currency: "EUR",
+			want:     &shopv2.Money{CurrencyCode: "EUR", Units: 45},
+		},
+		{
+			name:     "negative amount",
+			amount:   -0.5,
+			currency: "USD",
+			want:     &shopv2.Money{CurrencyCode: "USD", Nanos: -500000000},
+		},
+		{
+			name:     "amount rounded to minor unit",
+			amount:   1.23456,
+			currency: "EUR",
+			want:     &shopv2.Money{CurrencyCode: "EUR", Units: 1, Nanos: 230000000},
+		},
+		{
+			name:     "currency with three digit minor unit",
+			amount:   1.23456,
+			currency: "KWD",
+			want:     &shopv2.Money{CurrencyCode: "KWD", Units: 1, Nanos: 235000000},
+		},
+		{
+			name:     "currency without minor unit",
+			amount:   1234.6,
+			currency: "JPY",
+			want:     &shopv2.Money{CurrencyCode: "JPY", Units: 1235},
+		},
+		{
+			name:     "unknown currency",
+			amount:   1,
+			currency: "XYZ",
+			wantErr:  true,
+		},
+		{
+			name:     "not a number",
+			amount:   float32(math.NaN()),
+			currency: "EUR",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromFloat(tt.amount, tt.currency)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+				assert.NoError(t, Validate(got))
+			}
+		})
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *shopv2.Money
+		want float32
+	}{
+		{
+			name: "amount with nanos",
+			m:    &shopv2.Money{CurrencyCode: "EUR", Units: 100, Nanos: 150000000},
+			want: 100.15,
+		},
+		{
+			name: "negative amount",
+			m:    &shopv2.Money{CurrencyCode: "EUR", Units: -2, Nanos: -10000000},
+			want: -2.01,
+		},
+		{
+			name: "money not set",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ToFloat(tt.m))
+		})
+	}
+}
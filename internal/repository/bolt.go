@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+// itemsBucket holds the items serialized as protobuf keyed by their ID.
+var itemsBucket = []byte("items")
+
+// BoltRepo represents repository of items stored in bbolt database file. Every change is synced to the disk
+// before it is returned and the file is locked so no other process can open it meanwhile.
+type BoltRepo struct {
+	db *bolt.DB
+}
+
+// NewBoltRepo opens the database file, it fails when the file is not unlocked by other process within the timeout.
+func NewBoltRepo(cfg BoltConfig) (*BoltRepo, error) {
+	db, err := bolt.Open(cfg.Path, 0600, &bolt.Options{Timeout: cfg.OpenTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open bolt database '%s'", cfg.Path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(itemsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to create items bucket")
+	}
+
+	return &BoltRepo{db: db}, nil
+}
+
+// Close closes the database file and releases its lock.
+func (r *BoltRepo) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks the database file is open.
+func (r *BoltRepo) Ping(ctx context.Context) error {
+	return r.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+func (r *BoltRepo) Get(ctx context.Context, id string) (*shopv2.Item, error) {
+	var i *shopv2.Item
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		i, err = getItem(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if i == nil {
+		return nil, NotFoundErr
+	}
+
+	return i, nil
+}
+
+func (r *BoltRepo) GetAll(ctx context.Context) ([]*shopv2.Item, error) {
+	var items []*shopv2.Item
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(_, v []byte) error {
+			i, err := unmarshalItem(v)
+			if err != nil {
+				return err
+			}
+			items = append(items, i)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// List returns at most limit items with ID greater than the after cursor, ordered by ID.
+// Empty after cursor starts the listing from the first item.
+func (r *BoltRepo) List(ctx context.Context, after string, limit int) ([]*shopv2.Item, error) {
+	items := make([]*shopv2.Item, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(itemsBucket).Cursor()
+		k, v := c.Seek([]byte(after))
+		if k != nil && bytes.Equal(k, []byte(after)) {
+			k, v = c.Next()
+		}
+		for ; k != nil && len(items) < limit; k, v = c.Next() {
+			i, err := unmarshalItem(v)
+			if err != nil {
+				return err
+			}
+			items = append(items, i)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Upsert stores the item and sets its version to the next one. When expected version is not zero, the item
+// has to be already stored with the expected version.
+func (r *BoltRepo) Upsert(ctx context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		current, err := checkStoredVersion(tx, i.GetId(), expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		stored := proto.Clone(i).(*shopv2.Item)
+		stored.Version = current.GetVersion() + 1
+		b, err := proto.Marshal(stored)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal item")
+		}
+		if err := tx.Bucket(itemsBucket).Put([]byte(i.GetId()), b); err != nil {
+			return err
+		}
+		i.Version = stored.Version
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Debugf("Item '%s' stored in version %d.", i.GetId(), i.GetVersion())
+	return i, nil
+}
+
+// Remove removes the existing item. When expected version is not zero, the item has to be stored with the expected version.
+func (r *BoltRepo) Remove(ctx context.Context, id string, expectedVersion int64) error {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		current, err := checkStoredVersion(tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return NotFoundErr
+		}
+		return tx.Bucket(itemsBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).Debugf("Item '%s' removed.", id)
+	return nil
+}
+
+// checkStoredVersion returns the stored item if its version matches the expected one, any version matches zero.
+func checkStoredVersion(tx *bolt.Tx, id string, expectedVersion int64) (*shopv2.Item, error) {
+	current, err := getItem(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion == 0 {
+		return current, nil
+	}
+	if current == nil {
+		return nil, NotFoundErr
+	}
+	if current.GetVersion() != expectedVersion {
+		return nil, VersionMismatchErr
+	}
+	return current, nil
+}
+
+// getItem returns the stored item or nil when it doesn't exist.
+func getItem(tx *bolt.Tx, id string) (*shopv2.Item, error) {
+	v := tx.Bucket(itemsBucket).Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	return unmarshalItem(v)
+}
+
+func unmarshalItem(b []byte) (*shopv2.Item, error) {
+	i := &shopv2.Item{}
+	if err := proto.Unmarshal(b, i); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal item")
+	}
+	return i, nil
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestBoltRepo(t *testing.T, items ...*shopv2.Item) *BoltRepo {
+	r, err := NewBoltRepo(BoltConfig{Path: filepath.Join(t.TempDir(), "shop.db"), OpenTimeout: time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		for _, i := range items {
+			b, err := proto.Marshal(i)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(itemsBucket).Put([]byte(i.GetId()), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return r
+}
+
+func assertItems(t *testing.T, want, got []*shopv2.Item) {
+	require.Len(t, got, len(want))
+	for idx := range want {
+		assert.True(t, proto.Equal(want[idx], got[idx]), "want %v, got %v", want[idx], got[idx])
+	}
+}
+
+func TestBoltRepo_Get(t *testing.T) {
+	r := newTestBoltRepo(t, &i1, &i2)
+
+	got, err := r.Get(context.Background(), "id-1")
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(&i1, got))
+
+	_, err = r.Get(context.Background(), "id-3")
+	assert.ErrorIs(t, err, NotFoundErr)
+}
+
+func TestBoltRepo_List(t *testing.T) {
+	i3 := shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 300000000)}
+	tests := []struct {
+		name  string
+		items []*shopv2.Item
+		after string
+		limit int
+		want  []*shopv2.Item
+	}{
+		{
+			name:  "first page",
+			items: []*shopv2.Item{&i3, &i1, &i2},
+			limit: 2,
+			want:  []*shopv2.Item{&i1, &i2},
+		},
+		{
+			name:  "page after cursor",
+			items: []*shopv2.Item{&i3, &i1, &i2},
+			after: "id-1",
+			limit: 5,
+			want:  []*shopv2.Item{&i2, &i3},
+		},
+		{
+			name:  "cursor of removed item",
+			items: []*shopv2.Item{&i3, &i1},
+			after: "id-2",
+			limit: 5,
+			want:  []*shopv2.Item{&i3},
+		},
+		{
+			name:  "no items after cursor",
+			items: []*shopv2.Item{&i1, &i2},
+			after: "id-2",
+			limit: 5,
+			want:  []*shopv2.Item{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestBoltRepo(t, tt.items...)
+
+			got, err := r.List(context.Background(), tt.after, tt.limit)
+
+			assert.NoError(t, err)
+			assertItems(t, tt.want, got)
+		})
+	}
+}
+
+func TestBoltRepo_Upsert(t *testing.T) {
+	stored := &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 100000000), Version: 2}
+	tests := []struct {
+		name            string
+		i               *shopv2.Item
+		expectedVersion int64
+		want            *shopv2.Item
+		wantErr         error
+	}{
+		{
+			name: "upsert non existing",
+			i:    &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			want: &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000), Version: 1},
+		},
+		{
+			name:            "upsert existing with matching version",
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 2,
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name:            "upsert existing with not matching version",
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 1,
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "upsert non existing with version",
+			i:               &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			expectedVersion: 1,
+			wantErr:         NotFoundErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestBoltRepo(t, stored)
+
+			got, err := r.Upsert(context.Background(), tt.i, tt.expectedVersion)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.True(t, proto.Equal(tt.want, got))
+				saved, err := r.Get(context.Background(), tt.i.GetId())
+				assert.NoError(t, err)
+				assert.True(t, proto.Equal(tt.want, saved))
+			} else {
+				all, err := r.GetAll(context.Background())
+				assert.NoError(t, err)
+				assertItems(t, []*shopv2.Item{stored}, all)
+			}
+		})
+	}
+}
+
+func TestBoltRepo_Remove(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string
+		expectedVersion int64
+		want            []*shopv2.Item
+		wantErr         error
+	}{
+		{
+			name: "Remove existing",
+			id:   "id-2",
+			want: []*shopv2.Item{&i1},
+		},
+		{
+			name:    "Remove non existing",
+			id:      "id-5",
+			want:    []*shopv2.Item{&i1, &i2},
+			wantErr: NotFoundErr,
+		},
+		{
+			name:            "Remove existing with matching version",
+			id:              "id-2",
+			expectedVersion: 2,
+			want:            []*shopv2.Item{&i1},
+		},
+		{
+			name:            "Remove existing with not matching version",
+			id:              "id-2",
+			expectedVersion: 1,
+			want:            []*shopv2.Item{&i1, &i2},
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "Remove non existing with version",
+			id:              "id-5",
+			expectedVersion: 1,
+			want:            []*shopv2.Item{&i1, &i2},
+			wantErr:         NotFoundErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestBoltRepo(t, &i1, &i2)
+
+			err := r.Remove(context.Background(), tt.id, tt.expectedVersion)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			got, err := r.List(context.Background(), "", 10)
+			assert.NoError(t, err)
+			assertItems(t, tt.want, got)
+		})
+	}
+}
+
+func TestBoltRepo_Reopen(t *testing.T) {
+	cfg := BoltConfig{Path: filepath.Join(t.TempDir(), "shop.db"), OpenTimeout: 100 * time.Millisecond}
+	r, err := NewBoltRepo(cfg)
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+
+	_, err = NewBoltRepo(cfg)
+	assert.Error(t, err, "locked database must not be opened")
+
+	require.NoError(t, r.Close())
+	r, err = NewBoltRepo(cfg)
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := r.Get(context.Background(), "id-1")
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(&shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1}, got))
+}
+
+func TestBoltRepo_Ping(t *testing.T) {
+	r, err := NewBoltRepo(BoltConfig{Path: filepath.Join(t.TempDir(), "shop.db"), OpenTimeout: time.Second})
+	require.NoError(t, err)
+	assert.NoError(t, r.Ping(context.Background()))
+
+	require.NoError(t, r.Close())
+	assert.Error(t, r.Ping(context.Background()))
+}
@@ -0,0 +1,67 @@
+package repository
+
+import "time"
+
+const (
+	// MemoryBackend keeps the items in app memory, they are lost on restart unless the memory directory is set.
+	MemoryBackend = "memory"
+	// BoltBackend stores the items in an embedded bbolt database file.
+	BoltBackend = "bolt"
+	// SQLBackend stores the items in a relational database.
+	SQLBackend = "sql"
+)
+
+// Config of the items repository.
+type Config struct {
+	// Backend is the repository implementation, one of memory, bolt and sql.
+	Backend string
+	Memory  MemoryConfig
+	Bolt    BoltConfig
+	SQL     SQLConfig
+}
+
+// MemoryConfig in memory repository persistence options.
+type MemoryConfig struct {
+	// Dir holds the snapshots and the write-ahead log of the items, the items are not persisted when empty.
+	Dir string
+	// Durability of the changes, one of fsync, batch and none.
+	Durability string
+	// BatchInterval is how often the write-ahead log is synced in the batch durability, it must be positive.
+	BatchInterval time.Duration
+	// SnapshotInterval is how often the write-ahead log is compacted into a new snapshot, it must be positive.
+	SnapshotInterval time.Duration
+}
+
+// BoltConfig bbolt database options.
+type BoltConfig struct {
+	// Path of the database file, it is created when it doesn't exist.
+	Path string
+	// OpenTimeout is how long to wait for the lock of the database file held by other process.
+	OpenTimeout time.Duration
+}
+
+// SQLConfig relational database options.
+type SQLConfig struct {
+	// Driver is the database/sql driver name, sqlite or postgres.
+	Driver string
+	// DSN is the data source name passed to the driver.
+	DSN string
+}
+
+// DefaultConfig default items repository options.
+var DefaultConfig = Config{
+	Backend: MemoryBackend,
+	Memory: MemoryConfig{
+		Durability:       DurabilityFsync,
+		BatchInterval:    10 * time.Millisecond,
+		SnapshotInterval: 5 * time.Minute,
+	},
+	Bolt: BoltConfig{
+		Path:        "shop.db",
+		OpenTimeout: 5 * time.Second,
+	},
+	SQL: SQLConfig{
+		Driver: "sqlite",
+		DSN:    "file:shop.sqlite?_pragma=busy_timeout(5000)",
+	},
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package repository
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes the exclusive lock of the file without waiting for it.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
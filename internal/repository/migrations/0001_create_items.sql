@@ -0,0 +1,8 @@
+CREATE TABLE items (
+    id             VARCHAR(64) PRIMARY KEY,
+    name           TEXT        NOT NULL,
+    price_currency VARCHAR(3)  NOT NULL,
+    price_units    BIGINT      NOT NULL,
+    price_nanos    INTEGER     NOT NULL,
+    version        BIGINT      NOT NULL
+);
@@ -1,29 +1,54 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
-	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"go.uber.org/zap"
+	"os"
+	"sort"
 	"sync"
 )
 
-var NotFoundErr = errors.New("Item not found")
+var (
+	NotFoundErr        = errors.New("Item not found")
+	VersionMismatchErr = errors.New("Item version mismatch")
+)
 
-// InMemoryRepo represents repository of items protected by RW lock.
+// InMemoryRepo represents repository of items protected by RW lock. The changes of the items are written
+// to the write-ahead log when the repository is persisted, the readers are served the changes once durable.
 type InMemoryRepo struct {
 	items items
 	lock  sync.RWMutex
+	// pending are the changes of the items by their IDs in the order they were logged, not yet durable.
+	// The versions of the next changes are checked against them.
+	pending map[string][]*change
+
+	wal *wal
+	// dirLock is the locked file keeping other processes off the directory of the persisted repository.
+	dirLock        *os.File
+	log            *zap.SugaredLogger
+	stopCompaction chan struct{}
+	compactionDone chan struct{}
 }
 
 // items maps item ID to item.
-type items map[string]*proto.Item
+type items map[string]*shopv2.Item
+
+// change of the item waiting to be durable, the item is nil when it is removed.
+type change struct {
+	item *shopv2.Item
+}
 
 // NewInMemoryRepo creates a new empty repository that holds items in app memory.
 func NewInMemoryRepo() *InMemoryRepo {
-	items := make(map[string]*proto.Item)
+	items := make(map[string]*shopv2.Item)
 	return &InMemoryRepo{items: items}
 }
 
-func (r *InMemoryRepo) Get(id string) (*proto.Item, error) {
+func (r *InMemoryRepo) Get(ctx context.Context, id string) (*shopv2.Item, error) {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
@@ -35,30 +60,170 @@ func (r *InMemoryRepo) Get(id string) (*proto.Item, error) {
 	return z, nil
 }
 
-func (r *InMemoryRepo) GetAll() (*proto.ItemsList, error) {
+func (r *InMemoryRepo) GetAll(ctx context.Context) ([]*shopv2.Item, error) {
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
-	var items []*proto.Item
+	var items []*shopv2.Item
 	for _, v := range r.items {
 		items = append(items, v)
 	}
 
-	return &proto.ItemsList{Items: items}, nil
+	return items, nil
 }
 
-func (r *InMemoryRepo) Upsert(i *proto.Item) (*proto.Item, error) {
+// List returns at most limit items with ID greater than the after cursor, ordered by ID.
+// Empty after cursor starts the listing from the first item.
+func (r *InMemoryRepo) List(ctx context.Context, after string, limit int) ([]*shopv2.Item, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var ids []string
+	for id := range r.items {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	items := make([]*shopv2.Item, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, r.items[id])
+	}
+	return items, nil
+}
+
+// Upsert stores the item and sets its version to the next one. When expected version is not zero, the item
+// has to be already stored with the expected version.
+func (r *InMemoryRepo) Upsert(ctx context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error) {
 	r.lock.Lock()
-	defer r.lock.Unlock()
+	current, err := r.checkVersion(i.GetId(), expectedVersion)
+	if err != nil {
+		r.lock.Unlock()
+		return nil, err
+	}
 
-	r.items[i.GetId()] = i
+	i.Version = current.GetVersion() + 1
+	if err := r.applyChange(opUpsert, i.GetId(), i); err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Debugf("Item '%s' stored in version %d.", i.GetId(), i.GetVersion())
 	return i, nil
 }
 
-func (r *InMemoryRepo) Remove(id string) error {
+// Remove removes the existing item. When expected version is not zero, the item has to be stored with the expected version.
+func (r *InMemoryRepo) Remove(ctx context.Context, id string, expectedVersion int64) error {
 	r.lock.Lock()
-	defer r.lock.Unlock()
+	current, err := r.checkVersion(id, expectedVersion)
+	if err == nil && current == nil {
+		err = NotFoundErr
+	}
+	if err != nil {
+		r.lock.Unlock()
+		return err
+	}
 
-	delete(r.items, id)
+	if err := r.applyChange(opRemove, id, nil); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Debugf("Item '%s' removed.", id)
 	return nil
 }
+
+// applyChange logs the change of the item, nil item removes it, and applies it to the items once durable.
+// Must be called with the lock held, the lock is released.
+func (r *InMemoryRepo) applyChange(op walOp, id string, i *shopv2.Item) error {
+	durable, err := r.logChange(op, id, i)
+	if err != nil {
+		r.lock.Unlock()
+		return err
+	}
+	c := &change{item: i}
+	if r.pending == nil {
+		r.pending = make(map[string][]*change)
+	}
+	r.pending[id] = append(r.pending[id], c)
+	r.lock.Unlock()
+
+	// waiting outside of the lock lets the concurrent changes to be synced together
+	err = durable()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.commit(id, c, err == nil)
+	return err
+}
+
+// logChange writes the change to the write-ahead log if the repository is persisted and returns function waiting
+// until the change is durable. Must be called with the lock held.
+func (r *InMemoryRepo) logChange(op walOp, id string, i *shopv2.Item) (func() error, error) {
+	if r.wal == nil {
+		return func() error { return nil }, nil
+	}
+	if i == nil {
+		i = &shopv2.Item{Id: id}
+	}
+	return r.wal.append(op, i)
+}
+
+// commit applies the durable change of the item, or drops the failed one. The changes are durable in the order
+// they were logged and the write-ahead log fails all the changes following a failed one, so the durable change
+// applies also the preceding pending changes of the item. Must be called with the lock held.
+func (r *InMemoryRepo) commit(id string, c *change, durable bool) {
+	changes := r.pending[id]
+	n := -1
+	for k := range changes {
+		if changes[k] == c {
+			n = k
+		}
+	}
+	if n < 0 {
+		// already applied by a following durable change
+		return
+	}
+
+	if durable {
+		if c.item == nil {
+			delete(r.items, id)
+		} else {
+			r.items[id] = c.item
+		}
+		changes = changes[n+1:]
+	} else {
+		changes = append(changes[:n:n], changes[n+1:]...)
+	}
+	if len(changes) == 0 {
+		delete(r.pending, id)
+	} else {
+		r.pending[id] = changes
+	}
+}
+
+// latest returns the item including its pending changes. Must be called with the lock held.
+func (r *InMemoryRepo) latest(id string) (*shopv2.Item, bool) {
+	if changes := r.pending[id]; len(changes) > 0 {
+		i := changes[len(changes)-1].item
+		return i, i != nil
+	}
+	i, ok := r.items[id]
+	return i, ok
+}
+
+// checkVersion returns the stored item if its version matches the expected one, any version matches zero.
+// Must be called with the lock held.
+func (r *InMemoryRepo) checkVersion(id string, expectedVersion int64) (*shopv2.Item, error) {
+	current, ok := r.latest(id)
+	if expectedVersion == 0 {
+		return current, nil
+	}
+	if !ok {
+		return nil, NotFoundErr
+	}
+	if current.GetVersion() != expectedVersion {
+		return nil, VersionMismatchErr
+	}
+	return current, nil
+}
@@ -1,21 +1,27 @@
 package repository
 
 import (
-	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	"context"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
 	"github.com/stretchr/testify/assert"
-	"reflect"
 	"testing"
 )
 
-var i1 = proto.Item{
-	Id:    "id-1",
-	Name:  "name-1",
-	Price: 1.1,
+func eur(units int64, nanos int32) *shopv2.Money {
+	return &shopv2.Money{CurrencyCode: "EUR", Units: units, Nanos: nanos}
 }
-var i2 = proto.Item{
-	Id:    "id-2",
-	Name:  "name-2",
-	Price: 2.2,
+
+var i1 = shopv2.Item{
+	Id:      "id-1",
+	Name:    "name-1",
+	Price:   eur(1, 100000000),
+	Version: 1,
+}
+var i2 = shopv2.Item{
+	Id:      "id-2",
+	Name:    "name-2",
+	Price:   eur(2, 200000000),
+	Version: 2,
 }
 
 func TestInMemoryRepo_Get(t *testing.T) {
@@ -23,18 +29,18 @@ func TestInMemoryRepo_Get(t *testing.T) {
 		name    string
 		items   items
 		id      string
-		want    *proto.Item
+		want    *shopv2.Item
 		wantErr bool
 	}{
 		{
 			name:  "get present item",
-			items: map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
+			items: map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
 			id:    "id-1",
 			want:  &i1,
 		},
 		{
 			name:    "get non-present item",
-			items:   map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
+			items:   map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
 			id:      "id-3",
 			wantErr: true,
 		},
@@ -45,7 +51,7 @@ func TestInMemoryRepo_Get(t *testing.T) {
 				items: tt.items,
 			}
 
-			got, err := r.Get(tt.id)
+			got, err := r.Get(context.Background(), tt.id)
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			if !tt.wantErr {
@@ -59,18 +65,18 @@ func TestInMemoryRepo_GetAll(t *testing.T) {
 	tests := []struct {
 		name    string
 		items   items
-		want    *proto.ItemsList
+		want    []*shopv2.Item
 		wantErr bool
 	}{
 		{
 			name:  "items present in repo",
-			items: map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
-			want:  &proto.ItemsList{Items: []*proto.Item{&i1, &i2}},
+			items: map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:  []*shopv2.Item{&i1, &i2},
 		},
 		{
 			name:  "items empty",
-			items: map[string]*proto.Item{},
-			want:  &proto.ItemsList{},
+			items: map[string]*shopv2.Item{},
+			want:  nil,
 		},
 	}
 	for _, tt := range tests {
@@ -79,49 +85,120 @@ func TestInMemoryRepo_GetAll(t *testing.T) {
 				items: tt.items,
 			}
 
-			got, err := r.GetAll()
+			got, err := r.GetAll(context.Background())
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			if !tt.wantErr {
-				assert.True(t, reflect.DeepEqual(tt.want.Items, got.Items))
+				assert.ElementsMatch(t, tt.want, got)
 			}
 		})
 	}
 }
 
-func TestInMemoryRepo_Upsert(t *testing.T) {
+func TestInMemoryRepo_List(t *testing.T) {
+	i3 := shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 300000000)}
 	tests := []struct {
 		name    string
 		items   items
-		i       *proto.Item
-		want    *proto.Item
+		after   string
+		limit   int
+		want    []*shopv2.Item
 		wantErr bool
+	}{
+		{
+			name:  "first page",
+			items: map[string]*shopv2.Item{"id-3": &i3, "id-1": &i1, "id-2": &i2},
+			limit: 2,
+			want:  []*shopv2.Item{&i1, &i2},
+		},
+		{
+			name:  "page after cursor",
+			items: map[string]*shopv2.Item{"id-3": &i3, "id-1": &i1, "id-2": &i2},
+			after: "id-1",
+			limit: 5,
+			want:  []*shopv2.Item{&i2, &i3},
+		},
+		{
+			name:  "cursor of removed item",
+			items: map[string]*shopv2.Item{"id-3": &i3, "id-1": &i1},
+			after: "id-2",
+			limit: 5,
+			want:  []*shopv2.Item{&i3},
+		},
+		{
+			name:  "no items after cursor",
+			items: map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			after: "id-2",
+			limit: 5,
+			want:  []*shopv2.Item{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := InMemoryRepo{
+				items: tt.items,
+			}
+
+			got, err := r.List(context.Background(), tt.after, tt.limit)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInMemoryRepo_Upsert(t *testing.T) {
+	stored := func() items {
+		return map[string]*shopv2.Item{"id-1": {Id: "id-1", Name: "name-1", Price: eur(1, 100000000), Version: 2}}
+	}
+	tests := []struct {
+		name            string
+		items           items
+		i               *shopv2.Item
+		expectedVersion int64
+		want            *shopv2.Item
+		wantErr         error
 	}{
 		{
 			name:  "upsert non existing",
-			items: map[string]*proto.Item{"id-1": &i1},
-			i:     &i2,
-			want:  &i2,
+			items: stored(),
+			i:     &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			want:  &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000), Version: 1},
 		},
 		{
 			name:  "upsert existing",
-			items: map[string]*proto.Item{"id-1": &i1},
-			i: &proto.Item{
-				Id:    "id-1",
-				Name:  "updated-1",
-				Price: 5.5,
-			},
-			want: &proto.Item{
-				Id:    "id-1",
-				Name:  "updated-1",
-				Price: 5.5,
-			},
+			items: stored(),
+			i:     &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			want:  &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name:            "upsert existing with matching version",
+			items:           stored(),
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 2,
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name:            "upsert existing with not matching version",
+			items:           stored(),
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 1,
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "upsert non existing with version",
+			items:           stored(),
+			i:               &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			expectedVersion: 1,
+			wantErr:         NotFoundErr,
 		},
 		{
 			name:  "upsert item when items are empty",
-			items: map[string]*proto.Item{},
-			i:     &i1,
-			want:  &i1,
+			items: map[string]*shopv2.Item{},
+			i:     &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 100000000)},
+			want:  &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 100000000), Version: 1},
 		},
 	}
 	for _, tt := range tests {
@@ -130,11 +207,14 @@ func TestInMemoryRepo_Upsert(t *testing.T) {
 				items: tt.items,
 			}
 
-			got, err := r.Upsert(tt.i)
+			got, err := r.Upsert(context.Background(), tt.i, tt.expectedVersion)
 
-			assert.Equal(t, tt.wantErr, err != nil)
-			if !tt.wantErr {
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
 				assert.Equal(t, tt.want, got)
+				assert.Equal(t, tt.want, r.items[tt.i.GetId()])
+			} else {
+				assert.Equal(t, stored(), r.items)
 			}
 		})
 	}
@@ -142,23 +222,48 @@ func TestInMemoryRepo_Upsert(t *testing.T) {
 
 func TestInMemoryRepo_Remove(t *testing.T) {
 	tests := []struct {
-		name    string
-		items   items
-		id      string
-		want    items
-		wantErr bool
+		name            string
+		items           items
+		id              string
+		expectedVersion int64
+		want            items
+		wantErr         error
 	}{
 		{
 			name:  "Remove existing",
-			items: map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
-			want:  map[string]*proto.Item{"id-1": &i1},
+			items: map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:  map[string]*shopv2.Item{"id-1": &i1},
 			id:    "id-2",
 		},
 		{
-			name:  "Remove non existing",
-			items: map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
-			want:  map[string]*proto.Item{"id-1": &i1, "id-2": &i2},
-			id:    "id-5",
+			name:    "Remove non existing",
+			items:   map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:    map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			id:      "id-5",
+			wantErr: NotFoundErr,
+		},
+		{
+			name:            "Remove existing with matching version",
+			items:           map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:            map[string]*shopv2.Item{"id-1": &i1},
+			id:              "id-2",
+			expectedVersion: 2,
+		},
+		{
+			name:            "Remove existing with not matching version",
+			items:           map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:            map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			id:              "id-2",
+			expectedVersion: 1,
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "Remove non existing with version",
+			items:           map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			want:            map[string]*shopv2.Item{"id-1": &i1, "id-2": &i2},
+			id:              "id-5",
+			expectedVersion: 1,
+			wantErr:         NotFoundErr,
 		},
 	}
 	for _, tt := range tests {
@@ -167,9 +272,9 @@ func TestInMemoryRepo_Remove(t *testing.T) {
 				items: tt.items,
 			}
 
-			err := r.Remove(tt.id)
+			err := r.Remove(context.Background(), tt.id, tt.expectedVersion)
 
-			assert.Equal(t, tt.wantErr, err != nil)
+			assert.ErrorIs(t, err, tt.wantErr)
 			assert.Equal(t, tt.want, r.items)
 		})
 	}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"go.uber.org/zap"
+)
+
+// lockFileName is the file locked by the process using the items directory.
+const lockFileName = "LOCK"
+
+// OpenInMemoryRepo creates repository that holds items in app memory and persists their changes into
+// the write-ahead log in the directory. The items are restored from the latest snapshot and the log.
+// The directory is locked until the repository is closed so no other process uses it. The recovery and background
+// failures are logged to the logger.
+func OpenInMemoryRepo(cfg MemoryConfig, log *zap.SugaredLogger) (*InMemoryRepo, error) {
+	if cfg.SnapshotInterval <= 0 {
+		return nil, errors.Errorf("snapshot interval must be positive, got '%s'", cfg.SnapshotInterval)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create items directory")
+	}
+	lock, err := lockDir(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items, gen, err := loadItems(cfg.Dir, log)
+	if err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+	w, err := openWAL(cfg.Dir, gen, cfg.Durability, cfg.BatchInterval, log)
+	if err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+
+	r := &InMemoryRepo{items: items, wal: w, dirLock: lock, log: log, stopCompaction: make(chan struct{}), compactionDone: make(chan struct{})}
+	go r.compactPeriodically(cfg.SnapshotInterval)
+	return r, nil
+}
+
+// lockDir takes the exclusive lock of the directory, the lock is held until the returned file is closed.
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open items directory lock")
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "failed to lock items directory '%s', it may be used by another process", dir)
+	}
+	return f, nil
+}
+
+// Close stops the compaction and closes the write-ahead log, it's no-op for not persisted repository.
+func (r *InMemoryRepo) Close() error {
+	if r.wal == nil {
+		return nil
+	}
+
+	close(r.stopCompaction)
+	<-r.compactionDone
+	err := r.wal.close()
+	if lockErr := r.dirLock.Close(); err == nil {
+		err = lockErr
+	}
+	return err
+}
+
+// Ping checks the write-ahead log has not failed, the repository rejects the changes otherwise. It's no-op for
+// not persisted repository.
+func (r *InMemoryRepo) Ping(ctx context.Context) error {
+	if r.wal == nil {
+		return nil
+	}
+	return r.wal.failure()
+}
+
+func (r *InMemoryRepo) compactPeriodically(interval time.Duration) {
+	defer close(r.compactionDone)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stopCompaction:
+			return
+		case <-t.C:
+			if err := r.compact(); err != nil {
+				r.log.Errorf("Failed to compact items: %v", err)
+			}
+		}
+	}
+}
+
+// compact writes the snapshot of the items and removes the log and snapshots preceding it.
+func (r *InMemoryRepo) compact() error {
+	if r.wal.empty() {
+		return nil
+	}
+
+	// the snapshot holds the items as of the start of the new log generation, the pending changes logged
+	// in the previous generations are synced by the rotation
+	r.lock.Lock()
+	snapshot := make([]*shopv2.Item, 0, len(r.items))
+	for id, i := range r.items {
+		if _, ok := r.pending[id]; !ok {
+			snapshot = append(snapshot, i)
+		}
+	}
+	for id := range r.pending {
+		if i, ok := r.latest(id); ok {
+			snapshot = append(snapshot, i)
+		}
+	}
+	gen, err := r.wal.rotate()
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(r.wal.dir, gen, snapshot); err != nil {
+		return err
+	}
+	return removeFilesBefore(r.wal.dir, gen)
+}
+
+func snapshotPath(dir string, gen int64) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%020d.snap", gen))
+}
+
+// writeSnapshot writes the items into a temporary file which is renamed to the snapshot once synced.
+func writeSnapshot(dir string, gen int64, snapshot []*shopv2.Item) error {
+	tmp := snapshotPath(dir, gen) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot")
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	for _, i := range snapshot {
+		rec, err := encodeRecord(opUpsert, i)
+		if err != nil {
+			return err
+		}
+		if _, err := bw.Write(rec); err != nil {
+			return errors.Wrap(err, "failed to write snapshot")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write snapshot")
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync snapshot")
+	}
+	if err := os.Rename(tmp, snapshotPath(dir, gen)); err != nil {
+		return errors.Wrap(err, "failed to rename snapshot")
+	}
+	return syncDir(dir)
+}
+
+// loadItems restores the items from the latest snapshot and the logs following it and returns them together
+// with the generation of the last log. The torn record at the end of the last log is truncated, it could not be
+// acknowledged, while any other invalid record fails the loading.
+func loadItems(dir string, log *zap.SugaredLogger) (items, int64, error) {
+	snapshots, logs, err := listGenerations(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	loaded := make(items)
+	apply := func(op walOp, i *shopv2.Item) {
+		switch op {
+		case opUpsert:
+			loaded[i.GetId()] = i
+		case opRemove:
+			delete(loaded, i.GetId())
+		}
+	}
+
+	var gen int64
+	if len(snapshots) > 0 {
+		gen = snapshots[len(snapshots)-1]
+		if err := readFile(snapshotPath(dir, gen), apply, false, log); err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to read snapshot '%d'", gen)
+		}
+	}
+
+	for k, g := range logs {
+		if g < gen {
+			continue
+		}
+		gen = g
+		err := readFile(walPath(dir, g), apply, k == len(logs)-1, log)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to read write-ahead log '%d'", g)
+		}
+	}
+
+	return loaded, gen, nil
+}
+
+// readFile reads the records of the file, the torn record at the end of the file is truncated when allowed
+// and logged to the logger.
+func readFile(path string, fn func(op walOp, i *shopv2.Item), truncateTorn bool, log *zap.SugaredLogger) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := readRecords(f, fn)
+	if errors.Is(err, tornRecordErr) && truncateTorn {
+		log.Warnf("Truncating torn record at offset %d of '%s'.", offset, path)
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read record at offset %d", offset)
+	}
+	return nil
+}
+
+// listGenerations returns the sorted generations of the snapshots and the logs in the directory.
+func listGenerations(dir string) ([]int64, []int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshots, logs []int64
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// left over by interrupted snapshot
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if gen, ok := parseGeneration(name, "snapshot-", ".snap"); ok {
+			snapshots = append(snapshots, gen)
+		}
+		if gen, ok := parseGeneration(name, "wal-", ".log"); ok {
+			logs = append(logs, gen)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	return snapshots, logs, nil
+}
+
+func parseGeneration(name, prefix, suffix string) (int64, bool) {
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	gen, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64)
+	return gen, err == nil
+}
+
+// removeFilesBefore removes the snapshots and the logs of the generations preceding the given one.
+func removeFilesBefore(dir string, gen int64) error {
+	snapshots, logs, err := listGenerations(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range snapshots {
+		if g < gen {
+			if err := os.Remove(snapshotPath(dir, g)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, g := range logs {
+		if g < gen {
+			if err := os.Remove(walPath(dir, g)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+)
+
+// migrations are applied in the order of their version, the file name prefix.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const itemColumns = "id, name, price_currency, price_units, price_nanos, version"
+
+// SQLRepo represents repository of items stored in relational database. The queries are kept portable between
+// sqlite and postgres.
+type SQLRepo struct {
+	db     *sql.DB
+	driver string
+	// dollarParams is set for the drivers expecting $n query parameters placeholders instead of ?.
+	dollarParams bool
+}
+
+// NewSQLRepo connects to the database and applies the schema migrations not applied yet.
+func NewSQLRepo(cfg SQLConfig) (*SQLRepo, error) {
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open '%s' database", cfg.Driver)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "failed to connect to '%s' database", cfg.Driver)
+	}
+
+	r := &SQLRepo{db: db, driver: cfg.Driver, dollarParams: cfg.Driver == "postgres"}
+	if err := r.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close closes the database connections.
+func (r *SQLRepo) Close() error {
+	return r.db.Close()
+}
+
+// Ping checks the database is reachable.
+func (r *SQLRepo) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *SQLRepo) Get(ctx context.Context, id string) (*shopv2.Item, error) {
+	row := r.db.QueryRowContext(ctx, r.rebind("SELECT "+itemColumns+" FROM items WHERE id = ?"), id)
+	i, err := scanItem(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (r *SQLRepo) GetAll(ctx context.Context) ([]*shopv2.Item, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+itemColumns+" FROM items ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanItems(rows)
+}
+
+// List returns at most limit items with ID greater than the after cursor, ordered by ID.
+// Empty after cursor starts the listing from the first item.
+func (r *SQLRepo) List(ctx context.Context, after string, limit int) ([]*shopv2.Item, error) {
+	rows, err := r.db.QueryContext(ctx, r.rebind("SELECT "+itemColumns+" FROM items WHERE id > ? ORDER BY id LIMIT ?"), after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := scanItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = make([]*shopv2.Item, 0)
+	}
+	return items, nil
+}
+
+// Upsert stores the item and sets its version to the next one. When expected version is not zero, the item
+// has to be already stored with the expected version.
+func (r *SQLRepo) Upsert(ctx context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRowContext(ctx, r.rebind("SELECT version FROM items WHERE id = ?"), i.GetId()).Scan(&current)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if expectedVersion != 0 && !exists {
+		return nil, NotFoundErr
+	}
+	if expectedVersion != 0 && current != expectedVersion {
+		return nil, VersionMismatchErr
+	}
+
+	p := i.GetPrice()
+	if exists {
+		// the version condition guards against the item being changed since it was read
+		res, err := tx.ExecContext(ctx, r.rebind("UPDATE items SET name = ?, price_currency = ?, price_units = ?, price_nanos = ?, "+
+			"version = ? WHERE id = ? AND version = ?"),
+			i.GetName(), p.GetCurrencyCode(), p.GetUnits(), p.GetNanos(), current+1, i.GetId(), current)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			return nil, VersionMismatchErr
+		}
+	} else {
+		_, err := tx.ExecContext(ctx, r.rebind("INSERT INTO items ("+itemColumns+") VALUES (?, ?, ?, ?, ?, ?)"),
+			i.GetId(), i.GetName(), p.GetCurrencyCode(), p.GetUnits(), p.GetNanos(), 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	i.Version = current + 1
+	logging.FromContext(ctx).Debugf("Item '%s' stored in version %d.", i.GetId(), i.GetVersion())
+	return i, nil
+}
+
+// Remove removes the existing item. When expected version is not zero, the item has to be stored with the expected version.
+func (r *SQLRepo) Remove(ctx context.Context, id string, expectedVersion int64) error {
+	var res sql.Result
+	var err error
+	if expectedVersion == 0 {
+		res, err = r.db.ExecContext(ctx, r.rebind("DELETE FROM items WHERE id = ?"), id)
+	} else {
+		res, err = r.db.ExecContext(ctx, r.rebind("DELETE FROM items WHERE id = ? AND version = ?"), id, expectedVersion)
+	}
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		logging.FromContext(ctx).Debugf("Item '%s' removed.", id)
+		return nil
+	}
+
+	// nothing removed, either the item doesn't exist or it is in other version
+	if _, err := r.Get(ctx, id); err != nil {
+		return err
+	}
+	return VersionMismatchErr
+}
+
+// migrationsLockID is the postgres advisory lock key serializing the migrations of concurrently starting servers.
+const migrationsLockID = 7306283
+
+// migrate applies the embedded migrations which are not recorded in the schema_migrations table yet. The migrations
+// are applied in a single transaction holding the database lock so the concurrently starting servers apply them once.
+func (r *SQLRepo) migrate() error {
+	ctx := context.Background()
+	// the transaction is driven by statements as sqlite has to take the write lock when it begins
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	begin := "BEGIN"
+	if r.driver == "sqlite" {
+		begin = "BEGIN IMMEDIATE"
+	}
+	if _, err := conn.ExecContext(ctx, begin); err != nil {
+		return errors.Wrap(err, "failed to begin migrations transaction")
+	}
+	if err := r.migrateTx(ctx, conn); err != nil {
+		_, _ = conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return errors.Wrap(err, "failed to commit migrations")
+}
+
+func (r *SQLRepo) migrateTx(ctx context.Context, conn *sql.Conn) error {
+	if r.driver == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationsLockID); err != nil {
+			return errors.Wrap(err, "failed to lock migrations")
+		}
+	}
+
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name TEXT NOT NULL)")
+	if err != nil {
+		return errors.Wrap(err, "failed to create schema_migrations table")
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return errors.Wrap(err, "failed to read applied migrations")
+	}
+
+	// the entries are sorted by file name
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		version, err := strconv.ParseInt(strings.SplitN(f.Name(), "_", 2)[0], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid migration file name '%s'", f.Name())
+		}
+		if applied[version] {
+			continue
+		}
+		if err := r.applyMigration(ctx, conn, version, f.Name()); err != nil {
+			return errors.Wrapf(err, "failed to apply migration '%s'", f.Name())
+		}
+	}
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration executes the migration and records it.
+func (r *SQLRepo) applyMigration(ctx context.Context, conn *sql.Conn, version int64, name string) error {
+	stmt, err := migrations.ReadFile("migrations/" + name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, string(stmt)); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, r.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), version, name)
+	return err
+}
+
+// rebind replaces the ? placeholders by $n ones when the driver requires it.
+func (r *SQLRepo) rebind(query string) string {
+	if !r.dollarParams {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(s scanner) (*shopv2.Item, error) {
+	i := &shopv2.Item{Price: &shopv2.Money{}}
+	err := s.Scan(&i.Id, &i.Name, &i.Price.CurrencyCode, &i.Price.Units, &i.Price.Nanos, &i.Version)
+	if err != nil {
+		return nil, err
+	}
+	if i.Price.GetCurrencyCode() == "" {
+		i.Price = nil
+	}
+	return i, nil
+}
+
+func scanItems(rows *sql.Rows) ([]*shopv2.Item, error) {
+	defer rows.Close()
+
+	var items []*shopv2.Item
+	for rows.Next() {
+		i, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
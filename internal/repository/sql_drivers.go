@@ -0,0 +1,8 @@
+package repository
+
+import (
+	// registers postgres driver
+	_ "github.com/lib/pq"
+	// registers pure Go sqlite driver
+	_ "modernc.org/sqlite"
+)
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestSQLRepo(t *testing.T, items ...*shopv2.Item) *SQLRepo {
+	r, err := NewSQLRepo(SQLConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "shop.sqlite")})
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	for _, i := range items {
+		_, err := r.db.Exec("INSERT INTO items ("+itemColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+			i.GetId(), i.GetName(), i.GetPrice().GetCurrencyCode(), i.GetPrice().GetUnits(), i.GetPrice().GetNanos(), i.GetVersion())
+		require.NoError(t, err)
+	}
+	return r
+}
+
+func TestSQLRepo_Get(t *testing.T) {
+	r := newTestSQLRepo(t, &i1, &i2)
+
+	got, err := r.Get(context.Background(), "id-1")
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(&i1, got))
+
+	_, err = r.Get(context.Background(), "id-3")
+	assert.ErrorIs(t, err, NotFoundErr)
+}
+
+func TestSQLRepo_List(t *testing.T) {
+	i3 := shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 300000000)}
+	r := newTestSQLRepo(t, &i3, &i1, &i2)
+
+	got, err := r.List(context.Background(), "", 2)
+	assert.NoError(t, err)
+	assertItems(t, []*shopv2.Item{&i1, &i2}, got)
+
+	got, err = r.List(context.Background(), "id-2", 5)
+	assert.NoError(t, err)
+	assertItems(t, []*shopv2.Item{&i3}, got)
+
+	got, err = r.List(context.Background(), "id-3", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []*shopv2.Item{}, got)
+}
+
+func TestSQLRepo_Upsert(t *testing.T) {
+	stored := &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 100000000), Version: 2}
+	tests := []struct {
+		name            string
+		i               *shopv2.Item
+		expectedVersion int64
+		want            *shopv2.Item
+		wantErr         error
+	}{
+		{
+			name: "upsert non existing",
+			i:    &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			want: &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000), Version: 1},
+		},
+		{
+			name: "upsert existing",
+			i:    &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			want: &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name:            "upsert existing with matching version",
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 2,
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name:            "upsert existing with not matching version",
+			i:               &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000)},
+			expectedVersion: 1,
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "upsert non existing with version",
+			i:               &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 200000000)},
+			expectedVersion: 1,
+			wantErr:         NotFoundErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestSQLRepo(t, stored)
+
+			got, err := r.Upsert(context.Background(), tt.i, tt.expectedVersion)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.True(t, proto.Equal(tt.want, got))
+				saved, err := r.Get(context.Background(), tt.i.GetId())
+				assert.NoError(t, err)
+				assert.True(t, proto.Equal(tt.want, saved))
+			} else {
+				all, err := r.GetAll(context.Background())
+				assert.NoError(t, err)
+				assertItems(t, []*shopv2.Item{stored}, all)
+			}
+		})
+	}
+}
+
+func TestSQLRepo_Remove(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string
+		expectedVersion int64
+		want            []*shopv2.Item
+		wantErr         error
+	}{
+		{
+			name: "Remove existing",
+			id:   "id-2",
+			want: []*shopv2.Item{&i1},
+		},
+		{
+			name:    "Remove non existing",
+			id:      "id-5",
+			want:    []*shopv2.Item{&i1, &i2},
+			wantErr: NotFoundErr,
+		},
+		{
+			name:            "Remove existing with matching version",
+			id:              "id-2",
+			expectedVersion: 2,
+			want:            []*shopv2.Item{&i1},
+		},
+		{
+			name:            "Remove existing with not matching version",
+			id:              "id-2",
+			expectedVersion: 1,
+			want:            []*shopv2.Item{&i1, &i2},
+			wantErr:         VersionMismatchErr,
+		},
+		{
+			name:            "Remove non existing with version",
+			id:              "id-5",
+			expectedVersion: 1,
+			want:            []*shopv2.Item{&i1, &i2},
+			wantErr:         NotFoundErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestSQLRepo(t, &i1, &i2)
+
+			err := r.Remove(context.Background(), tt.id, tt.expectedVersion)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			got, err := r.GetAll(context.Background())
+			assert.NoError(t, err)
+			assertItems(t, tt.want, got)
+		})
+	}
+}
+
+func TestSQLRepo_Migrate(t *testing.T) {
+	cfg := SQLConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "shop.sqlite")}
+	r, err := NewSQLRepo(cfg)
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	// migrations already applied must not be applied again
+	r, err = NewSQLRepo(cfg)
+	require.NoError(t, err)
+	defer r.Close()
+	var applied int
+	require.NoError(t, r.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied))
+	files, err := migrations.ReadDir("migrations")
+	require.NoError(t, err)
+	assert.Equal(t, len(files), applied)
+	_, err = r.Get(context.Background(), "id-1")
+	assert.NoError(t, err)
+}
+
+func TestSQLRepo_MigrateLocked(t *testing.T) {
+	cfg := SQLConfig{Driver: "sqlite", DSN: "file:" + filepath.Join(t.TempDir(), "shop.sqlite") + "?_pragma=busy_timeout(5000)"}
+	r, err := NewSQLRepo(cfg)
+	require.NoError(t, err)
+	defer r.Close()
+	// another server migrating the database holds its write lock
+	conn, err := r.db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+
+	migrated := make(chan error, 1)
+	go func() {
+		r, err := NewSQLRepo(cfg)
+		if err == nil {
+			err = r.Close()
+		}
+		migrated <- err
+	}()
+	select {
+	case err := <-migrated:
+		t.Fatalf("migrations applied while the database is locked: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = conn.ExecContext(context.Background(), "COMMIT")
+	require.NoError(t, err)
+	require.NoError(t, <-migrated)
+}
+
+func TestSQLRepo_rebind(t *testing.T) {
+	r := SQLRepo{dollarParams: true}
+	got := r.rebind("UPDATE items SET name = ? WHERE id = ? AND version = ?")
+	assert.Equal(t, "UPDATE items SET name = $1 WHERE id = $2 AND version = $3", got)
+
+	r = SQLRepo{}
+	assert.Equal(t, "SELECT 1 WHERE ? = ?", r.rebind("SELECT 1 WHERE ? = ?"))
+}
+
+func TestSQLRepo_Ping(t *testing.T) {
+	r, err := NewSQLRepo(SQLConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "shop.sqlite")})
+	require.NoError(t, err)
+	assert.NoError(t, r.Ping(context.Background()))
+
+	require.NoError(t, r.Close())
+	assert.Error(t, r.Ping(context.Background()))
+}
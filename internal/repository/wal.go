@@ -0,0 +1,367 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DurabilityFsync syncs the write-ahead log to the disk before every change is acknowledged.
+	DurabilityFsync = "fsync"
+	// DurabilityBatch syncs the write-ahead log periodically, the changes are acknowledged once synced.
+	DurabilityBatch = "batch"
+	// DurabilityNone leaves syncing of the write-ahead log to the OS, the changes may be lost on OS crash.
+	DurabilityNone = "none"
+)
+
+type walOp byte
+
+const (
+	opUpsert walOp = 1
+	opRemove walOp = 2
+)
+
+const (
+	// recordHeaderSize is the size of the payload length and its checksum preceding the payload.
+	recordHeaderSize = 8
+	maxRecordSize    = 16 << 20
+)
+
+var (
+	// tornRecordErr is returned when the last record is incomplete or its checksum doesn't match, e.g. after a crash.
+	tornRecordErr = errors.New("torn record")
+	// corruptedRecordErr is returned when the invalid record is followed by other records.
+	corruptedRecordErr = errors.New("corrupted record")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeRecord encodes the change into the record of the payload length, payload checksum and payload
+// consisting of the operation and the item.
+func encodeRecord(op walOp, i *shopv2.Item) ([]byte, error) {
+	b, err := proto.Marshal(i)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal item")
+	}
+
+	rec := make([]byte, recordHeaderSize+1+len(b))
+	payload := rec[recordHeaderSize:]
+	payload[0] = byte(op)
+	copy(payload[1:], b)
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(rec[4:8], crc32.Checksum(payload, crcTable))
+	return rec, nil
+}
+
+// readRecords calls fn for every record read and returns the offset following the last valid record.
+// tornRecordErr is returned when the records end with an invalid one, e.g. written partially before a crash,
+// and corruptedRecordErr when the invalid record is followed by other data.
+func readRecords(r io.Reader, fn func(op walOp, i *shopv2.Item)) (int64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, tornRecordErr
+			}
+			return offset, err
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size < 1 || size > maxRecordSize {
+			return offset, invalidRecordErr(size == 0, br)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, tornRecordErr
+			}
+			return offset, err
+		}
+		i := &shopv2.Item{}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) || proto.Unmarshal(payload[1:], i) != nil {
+			return offset, invalidRecordErr(true, br)
+		}
+
+		fn(walOp(payload[0]), i)
+		offset += int64(recordHeaderSize + size)
+	}
+}
+
+// invalidRecordErr returns tornRecordErr when the invalid record may be torn and it is followed only by zeros
+// the file may be extended with on a crash, corruptedRecordErr otherwise.
+func invalidRecordErr(mayBeTorn bool, rest io.Reader) error {
+	if !mayBeTorn {
+		return corruptedRecordErr
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := rest.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return corruptedRecordErr
+			}
+		}
+		if err == io.EOF {
+			return tornRecordErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wal is the write-ahead log of the items changes. It is split into generations, a new generation is started
+// when the items are compacted into a snapshot.
+type wal struct {
+	dir        string
+	durability string
+	log        *zap.SugaredLogger
+
+	mu   sync.Mutex
+	f    walFile
+	gen  int64
+	size int64
+	// batch is synced by the next periodic sync, batch durability only.
+	batch *walBatch
+	// err fails the appends once the log failed to sync, the records written since the last successful sync
+	// cannot be trusted to be durable.
+	err error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// walFile is the open log file.
+type walFile interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+}
+
+// walBatch is the group of records synced together.
+type walBatch struct {
+	pending bool
+	// offset is the size of the log before the first record of the batch.
+	offset int64
+	synced chan struct{}
+	err    error
+}
+
+func newWALBatch() *walBatch {
+	return &walBatch{synced: make(chan struct{})}
+}
+
+// openWAL opens the log of the generation for appending.
+func openWAL(dir string, gen int64, durability string, batchInterval time.Duration, log *zap.SugaredLogger) (*wal, error) {
+	switch durability {
+	case DurabilityFsync, DurabilityBatch, DurabilityNone:
+	default:
+		return nil, errors.Errorf("unknown durability mode '%s'", durability)
+	}
+	if durability == DurabilityBatch && batchInterval <= 0 {
+		return nil, errors.Errorf("batch interval must be positive, got '%s'", batchInterval)
+	}
+
+	w := &wal{dir: dir, durability: durability, log: log, batch: newWALBatch(), stop: make(chan struct{}), done: make(chan struct{})}
+	if err := w.open(gen); err != nil {
+		return nil, err
+	}
+
+	if durability == DurabilityBatch {
+		go w.syncPeriodically(batchInterval)
+	} else {
+		close(w.done)
+	}
+	return w, nil
+}
+
+func walPath(dir string, gen int64) string {
+	return filepath.Join(dir, fmt.Sprintf("wal-%020d.log", gen))
+}
+
+// open opens the log file of the generation. Must be called with the lock held.
+func (w *wal) open(gen int64) error {
+	f, err := os.OpenFile(walPath(w.dir, gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open write-ahead log")
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := syncDir(w.dir); err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f, w.gen, w.size = f, gen, fi.Size()
+	return nil
+}
+
+// append writes the change to the log and returns the function waiting until the change is durable.
+func (w *wal) append(op walOp, i *shopv2.Item) (func() error, error) {
+	rec, err := encodeRecord(op, i)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return nil, errors.Wrap(w.err, "write-ahead log failed")
+	}
+	offset := w.size
+	if _, err := w.f.Write(rec); err != nil {
+		// the torn record would hide the following ones on restore
+		if terr := w.f.Truncate(offset); terr != nil {
+			w.err = terr
+		}
+		return nil, errors.Wrap(err, "failed to write to write-ahead log")
+	}
+	w.size += int64(len(rec))
+
+	switch w.durability {
+	case DurabilityFsync:
+		if err := w.f.Sync(); err != nil {
+			w.fail(offset, err)
+			return nil, errors.Wrap(err, "failed to sync write-ahead log")
+		}
+	case DurabilityBatch:
+		b := w.batch
+		if !b.pending {
+			b.pending, b.offset = true, offset
+		}
+		return func() error {
+			<-b.synced
+			return b.err
+		}, nil
+	}
+	return func() error { return nil }, nil
+}
+
+// rotate starts the next generation of the log and returns it, the records of the previous generations are
+// synced before.
+func (w *wal) rotate() (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, errors.Wrap(w.err, "write-ahead log failed")
+	}
+	if err := w.syncBatch(); err != nil {
+		return 0, err
+	}
+	if err := w.f.Close(); err != nil {
+		return 0, err
+	}
+	if err := w.open(w.gen + 1); err != nil {
+		return 0, err
+	}
+	return w.gen, nil
+}
+
+// empty reports whether nothing was written to the current generation of the log.
+func (w *wal) empty() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.size == 0
+}
+
+func (w *wal) close() error {
+	close(w.stop)
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.syncBatch(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func (w *wal) syncPeriodically(interval time.Duration) {
+	defer close(w.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+			w.mu.Lock()
+			if err := w.syncBatch(); err != nil {
+				w.log.Errorf("Failed to sync write-ahead log: %v", err)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// syncBatch syncs the log when there are records waiting for it and notifies the waiters.
+// Must be called with the lock held.
+func (w *wal) syncBatch() error {
+	b := w.batch
+	if !b.pending {
+		return nil
+	}
+
+	b.err = w.f.Sync()
+	if b.err != nil {
+		w.fail(b.offset, b.err)
+	}
+	close(b.synced)
+	w.batch = newWALBatch()
+	return b.err
+}
+
+// fail refuses the following appends after the failed sync. The records written since the offset are truncated
+// so they are not restored as they were not acknowledged. Must be called with the lock held.
+func (w *wal) fail(offset int64, err error) {
+	w.err = err
+	if err := w.f.Truncate(offset); err == nil {
+		w.size = offset
+	}
+}
+
+// failure returns the error the log failed with.
+func (w *wal) failure() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return errors.Wrap(w.err, "write-ahead log failed")
+	}
+	return nil
+}
+
+// syncDir syncs the directory so the files created or renamed in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,369 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/proto"
+)
+
+func testMemoryConfig(t *testing.T, durability string) MemoryConfig {
+	return MemoryConfig{
+		Dir:              t.TempDir(),
+		Durability:       durability,
+		BatchInterval:    time.Millisecond,
+		SnapshotInterval: time.Hour,
+	}
+}
+
+func assertStoredItems(t *testing.T, r *InMemoryRepo, want ...*shopv2.Item) {
+	got, err := r.List(context.Background(), "", 100)
+	require.NoError(t, err)
+	assertItems(t, want, got)
+}
+
+func TestOpenInMemoryRepo_Restore(t *testing.T) {
+	for _, durability := range []string{DurabilityFsync, DurabilityBatch, DurabilityNone} {
+		t.Run(durability, func(t *testing.T) {
+			cfg := testMemoryConfig(t, durability)
+			r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(1, 0)}, 1)
+			require.NoError(t, err)
+			require.NoError(t, r.Remove(context.Background(), "id-2", 0))
+			require.NoError(t, r.Close())
+
+			r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			defer r.Close()
+
+			assertStoredItems(t, r, &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(1, 0), Version: 2})
+		})
+	}
+}
+
+func TestOpenInMemoryRepo_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *MemoryConfig)
+	}{
+		{
+			name:   "unknown durability",
+			modify: func(cfg *MemoryConfig) { cfg.Durability = "sometimes" },
+		},
+		{
+			name:   "zero snapshot interval",
+			modify: func(cfg *MemoryConfig) { cfg.SnapshotInterval = 0 },
+		},
+		{
+			name: "negative batch interval",
+			modify: func(cfg *MemoryConfig) {
+				cfg.Durability = DurabilityBatch
+				cfg.BatchInterval = -time.Second
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testMemoryConfig(t, DurabilityFsync)
+			tt.modify(&cfg)
+
+			_, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOpenInMemoryRepo_Locked(t *testing.T) {
+	cfg := testMemoryConfig(t, DurabilityFsync)
+	r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+
+	_, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	assert.Error(t, err)
+
+	require.NoError(t, r.Close())
+	r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	assert.NoError(t, r.Close())
+}
+
+func TestOpenInMemoryRepo_TornRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{
+			name: "incomplete header",
+			tail: []byte{10, 0, 0},
+		},
+		{
+			name: "incomplete payload",
+			tail: []byte{10, 0, 0, 0, 1, 2, 3, 4, 1, 10},
+		},
+		{
+			name: "checksum mismatch",
+			tail: []byte{2, 0, 0, 0, 1, 2, 3, 4, 1, 10},
+		},
+		{
+			name: "zeros",
+			tail: make([]byte, 32),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testMemoryConfig(t, DurabilityFsync)
+			r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+
+			f, err := os.OpenFile(walPath(cfg.Dir, 0), os.O_WRONLY|os.O_APPEND, 0600)
+			require.NoError(t, err)
+			_, err = f.Write(tt.tail)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			assertStoredItems(t, r, &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1})
+
+			// the changes following the truncated record are restored as well
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			defer r.Close()
+			assertStoredItems(t, r,
+				&shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1},
+				&shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0), Version: 1})
+		})
+	}
+}
+
+func TestOpenInMemoryRepo_CorruptedRecord(t *testing.T) {
+	torn := []byte{10, 0, 0, 0, 1, 2, 3, 4, 1, 10}
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, dir string)
+	}{
+		{
+			name: "checksum mismatch followed by records",
+			corrupt: func(t *testing.T, dir string) {
+				b, err := os.ReadFile(walPath(dir, 0))
+				require.NoError(t, err)
+				b[recordHeaderSize+2]++
+				require.NoError(t, os.WriteFile(walPath(dir, 0), b, 0600))
+			},
+		},
+		{
+			name: "invalid length followed by records",
+			corrupt: func(t *testing.T, dir string) {
+				b, err := os.ReadFile(walPath(dir, 0))
+				require.NoError(t, err)
+				b[3] = 0xff
+				require.NoError(t, os.WriteFile(walPath(dir, 0), b, 0600))
+			},
+		},
+		{
+			name: "torn record of not the last log",
+			corrupt: func(t *testing.T, dir string) {
+				appendFile(t, walPath(dir, 0), torn)
+				require.NoError(t, os.WriteFile(walPath(dir, 1), nil, 0600))
+			},
+		},
+		{
+			name: "torn record of snapshot",
+			corrupt: func(t *testing.T, dir string) {
+				require.NoError(t, writeSnapshot(dir, 1, []*shopv2.Item{{Id: "id-1"}}))
+				appendFile(t, snapshotPath(dir, 1), torn)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testMemoryConfig(t, DurabilityFsync)
+			r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+			require.NoError(t, err)
+			_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+
+			tt.corrupt(t, cfg.Dir)
+
+			_, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func appendFile(t *testing.T, path string, b []byte) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestInMemoryRepo_Compact(t *testing.T) {
+	cfg := testMemoryConfig(t, DurabilityBatch)
+	r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, r.compact())
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 0)}, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.Remove(context.Background(), "id-1", 1))
+	require.NoError(t, r.Close())
+
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "*"))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{filepath.Join(cfg.Dir, lockFileName), snapshotPath(cfg.Dir, 1), walPath(cfg.Dir, 1)}, files)
+
+	r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer r.Close()
+	assertStoredItems(t, r,
+		&shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0), Version: 1},
+		&shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 0), Version: 1})
+}
+
+func TestReadRecords(t *testing.T) {
+	rec1, err := encodeRecord(opUpsert, &i1)
+	require.NoError(t, err)
+	rec2, err := encodeRecord(opRemove, &shopv2.Item{Id: "id-2"})
+	require.NoError(t, err)
+	f := filepath.Join(t.TempDir(), "records")
+	require.NoError(t, os.WriteFile(f, append(rec1, rec2[:len(rec2)-1]...), 0600))
+
+	var got []*shopv2.Item
+	err = readFile(f, func(op walOp, i *shopv2.Item) {
+		assert.Equal(t, opUpsert, op)
+		got = append(got, i)
+	}, true, zaptest.NewLogger(t).Sugar())
+
+	assert.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.True(t, proto.Equal(&i1, got[0]))
+	b, err := os.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, rec1, b, "torn record must be truncated")
+}
+
+// failingFile fails syncing of the log.
+type failingFile struct {
+	walFile
+	syncErr error
+}
+
+func (f *failingFile) Sync() error {
+	return f.syncErr
+}
+
+func TestInMemoryRepo_BatchSyncFailure(t *testing.T) {
+	cfg := testMemoryConfig(t, DurabilityBatch)
+	r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+
+	r.wal.mu.Lock()
+	f := r.wal.f
+	r.wal.f = &failingFile{walFile: f, syncErr: errors.New("disk failure")}
+	r.wal.mu.Unlock()
+
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(1, 0)}, 1)
+	assert.Error(t, err)
+	assert.Error(t, r.Remove(context.Background(), "id-1", 0))
+
+	// the failed changes are not served
+	assertStoredItems(t, r, &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1})
+
+	r.wal.mu.Lock()
+	r.wal.f = f
+	r.wal.mu.Unlock()
+}
+
+// tornFile writes only the part of the record and fails.
+type tornFile struct {
+	walFile
+}
+
+func (f *tornFile) Write(b []byte) (int, error) {
+	n, _ := f.walFile.Write(b[:len(b)/2])
+	return n, errors.New("disk full")
+}
+
+func TestWAL_WriteFailure(t *testing.T) {
+	cfg := testMemoryConfig(t, DurabilityFsync)
+	r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+
+	f := r.wal.f
+	r.wal.f = &tornFile{walFile: f}
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+	assert.Error(t, err)
+	r.wal.f = f
+
+	// the torn record is truncated so the following records are restored
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 0)}, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer r.Close()
+	assertStoredItems(t, r,
+		&shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1},
+		&shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 0), Version: 1})
+}
+
+func TestWAL_SyncFailure(t *testing.T) {
+	cfg := testMemoryConfig(t, DurabilityFsync)
+	r, err := OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0)}, 0)
+	require.NoError(t, err)
+	assert.NoError(t, r.Ping(context.Background()))
+
+	f := r.wal.f
+	r.wal.f = &failingFile{walFile: f, syncErr: errors.New("disk failure")}
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-2", Name: "name-2", Price: eur(2, 0)}, 0)
+	assert.Error(t, err)
+	r.wal.f = f
+
+	// the log refuses the changes once it failed to sync and the repository reports it
+	_, err = r.Upsert(context.Background(), &shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 0)}, 0)
+	assert.Error(t, err)
+	assert.Error(t, r.compact())
+	assert.Error(t, r.Ping(context.Background()))
+	require.NoError(t, r.Close())
+
+	r, err = OpenInMemoryRepo(cfg, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	defer r.Close()
+	assertStoredItems(t, r, &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1})
+}
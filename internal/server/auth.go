@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// client authentication modes
+const (
+	// ClientAuthMTLS requires the client certificate.
+	ClientAuthMTLS = "mtls"
+	// ClientAuthJWT requires the bearer token, client certificates are not requested.
+	ClientAuthJWT = "jwt"
+	// ClientAuthMTLSOrJWT requires either the client certificate or the bearer token.
+	ClientAuthMTLSOrJWT = "mtls_or_jwt"
+)
+
+// Principal is the authenticated client.
+type Principal struct {
+	// Name is the certificate common name or the token subject.
+	Name string
+	// Identities are the certificate identities 'cn:<common name>', 'ou:<organizational unit>', 'dns:<DNS SAN>',
+	// 'uri:<URI SAN>' or the token identity 'sub:<subject>'.
+	Identities []string
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the authenticated client of the call.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Authenticator authenticates the clients by their certificates or bearer tokens according to the mode.
+type Authenticator struct {
+	mode  string
+	token *TokenVerifier
+}
+
+// NewAuthenticator returns authenticator of the mode, token verifier is required by the modes accepting tokens.
+func NewAuthenticator(mode string, token *TokenVerifier) *Authenticator {
+	return &Authenticator{mode: mode, token: token}
+}
+
+// UnaryServerInterceptor returns interceptor putting the authenticated client principal to the context,
+// rejecting unauthenticated calls with Unauthenticated status. The health service calls are not authenticated.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		p, err := a.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, principalKey{}, p), req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor putting the authenticated client principal to the stream context,
+// rejecting unauthenticated calls with Unauthenticated status. The health service calls are not authenticated.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isHealthMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		p, err := a.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = context.WithValue(ss.Context(), principalKey{}, p)
+		return handler(srv, wrapped)
+	}
+}
+
+func (a *Authenticator) authenticate(ctx context.Context) (*Principal, error) {
+	if a.mode != ClientAuthJWT {
+		if p, ok := certPrincipal(ctx); ok {
+			return p, nil
+		}
+		if a.mode == ClientAuthMTLS {
+			return nil, status.Error(codes.Unauthenticated, "Client certificate is required.")
+		}
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "Bearer token is required.")
+	}
+	p, err := a.token.Verify(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid bearer token: %v.", err)
+	}
+	return p, nil
+}
+
+// certPrincipal returns the principal of the verified client certificate.
+func certPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	c := tlsInfo.State.VerifiedChains[0][0]
+	principal := &Principal{Name: c.Subject.CommonName}
+	if c.Subject.CommonName != "" {
+		principal.Identities = append(principal.Identities, "cn:"+c.Subject.CommonName)
+	}
+	for _, ou := range c.Subject.OrganizationalUnit {
+		principal.Identities = append(principal.Identities, "ou:"+ou)
+	}
+	for _, dns := range c.DNSNames {
+		principal.Identities = append(principal.Identities, "dns:"+dns)
+	}
+	for _, uri := range c.URIs {
+		principal.Identities = append(principal.Identities, "uri:"+uri.String())
+	}
+	return principal, true
+}
+
+// bearerToken returns the token of the 'authorization: Bearer <token>' metadata.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		const prefix = "bearer "
+		if len(v) > len(prefix) && strings.EqualFold(v[:len(prefix)], prefix) {
+			return strings.TrimSpace(v[len(prefix):]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthenticator_UnaryServerInterceptor(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	verifier := newTestTokenVerifier(t, &key.PublicKey)
+	validToken := signToken(t, jwt.SigningMethodRS256, key, validClaims())
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}
+
+	tests := []struct {
+		name          string
+		mode          string
+		cert          *x509.Certificate
+		token         string
+		wantCode      codes.Code
+		wantPrincipal *Principal
+	}{
+		{
+			name:          "mTLS client certificate",
+			mode:          ClientAuthMTLS,
+			cert:          cert,
+			wantPrincipal: &Principal{Name: "client", Identities: []string{"cn:client"}},
+		},
+		{
+			name:     "mTLS without client certificate",
+			mode:     ClientAuthMTLS,
+			token:    validToken,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "JWT bearer token",
+			mode:          ClientAuthJWT,
+			token:         validToken,
+			wantPrincipal: &Principal{Name: "batch-job", Identities: []string{"sub:batch-job"}},
+		},
+		{
+			name:     "JWT without bearer token",
+			mode:     ClientAuthJWT,
+			cert:     cert,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "mTLS or JWT with client certificate",
+			mode:          ClientAuthMTLSOrJWT,
+			cert:          cert,
+			wantPrincipal: &Principal{Name: "client", Identities: []string{"cn:client"}},
+		},
+		{
+			name:          "mTLS or JWT with bearer token",
+			mode:          ClientAuthMTLSOrJWT,
+			token:         validToken,
+			wantPrincipal: &Principal{Name: "batch-job", Identities: []string{"sub:batch-job"}},
+		},
+		{
+			name:     "mTLS or JWT with invalid bearer token",
+			mode:     ClientAuthMTLSOrJWT,
+			token:    "invalid",
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.cert != nil {
+				ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{
+					State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}},
+				}})
+			}
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+			interceptor := NewAuthenticator(tt.mode, verifier).UnaryServerInterceptor()
+
+			var got *Principal
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				got, _ = PrincipalFromContext(ctx)
+				return nil, nil
+			})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantPrincipal, got)
+		})
+	}
+}
+
+func TestTokenVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	verifier := newTestTokenVerifier(t, &key.PublicKey, &ecKey.PublicKey)
+
+	withClaims := func(modify func(c *jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := validClaims()
+		modify(&c)
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "valid RS256 token",
+			token: signToken(t, jwt.SigningMethodRS256, key, validClaims(), "key-0"),
+		},
+		{
+			name:  "valid ES256 token",
+			token: signToken(t, jwt.SigningMethodES256, ecKey, validClaims(), "key-1"),
+		},
+		{
+			name:    "token signed by unknown key",
+			token:   signToken(t, jwt.SigningMethodRS256, otherKey, validClaims(), "key-0"),
+			wantErr: true,
+		},
+		{
+			name:    "token with unknown key ID",
+			token:   signToken(t, jwt.SigningMethodRS256, key, validClaims(), "key-2"),
+			wantErr: true,
+		},
+		{
+			name:    "token with algorithm not allowed",
+			token:   signToken(t, jwt.SigningMethodRS512, key, validClaims(), "key-0"),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned token",
+			token:   signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims(), "key-0"),
+			wantErr: true,
+		},
+		{
+			name: "expired token",
+			token: signToken(t, jwt.SigningMethodRS256, key, withClaims(func(c *jwt.RegisteredClaims) {
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			}), "key-0"),
+			wantErr: true,
+		},
+		{
+			name: "token without expiry",
+			token: signToken(t, jwt.SigningMethodRS256, key, withClaims(func(c *jwt.RegisteredClaims) {
+				c.ExpiresAt = nil
+			}), "key-0"),
+			wantErr: true,
+		},
+		{
+			name: "token of other issuer",
+			token: signToken(t, jwt.SigningMethodRS256, key, withClaims(func(c *jwt.RegisteredClaims) {
+				c.Issuer = "https://other.example.com"
+			}), "key-0"),
+			wantErr: true,
+		},
+		{
+			name: "token for other audience",
+			token: signToken(t, jwt.SigningMethodRS256, key, withClaims(func(c *jwt.RegisteredClaims) {
+				c.Audience = jwt.ClaimStrings{"other"}
+			}), "key-0"),
+			wantErr: true,
+		},
+		{
+			name: "token without subject",
+			token: signToken(t, jwt.SigningMethodRS256, key, withClaims(func(c *jwt.RegisteredClaims) {
+				c.Subject = ""
+			}), "key-0"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.token)
+
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func validClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    "https://issuer.example.com",
+		Subject:   "batch-job",
+		Audience:  jwt.ClaimStrings{"shop"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.RegisteredClaims, kid ...string) string {
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid[0]
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+// newTestTokenVerifier returns verifier with JWKS of the keys with IDs 'key-<index>'.
+func newTestTokenVerifier(t *testing.T, keys ...interface{}) *TokenVerifier {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	var set jwks
+	for i, k := range keys {
+		kid := "key-" + strconv.Itoa(i)
+		switch k := k.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "RSA", Kid: kid, N: encode(k.N), E: encode(big.NewInt(int64(k.E)))})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: encode(k.X), Y: encode(k.Y)})
+		}
+	}
+	b, err := json.Marshal(set)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, b, 0o600))
+
+	v, err := NewTokenVerifier(JWTConfig{
+		JWKSFile:   file,
+		Issuer:     "https://issuer.example.com",
+		Audience:   "shop",
+		Algorithms: DefaultJWTConfig.Algorithms,
+	})
+	require.NoError(t, err)
+	return v
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// anyPrincipal and anyMethod match every principal and method in the authorization rules.
+const (
+	anyPrincipal = "*"
+	anyMethod    = "*"
+	groupPrefix  = "group:"
+)
+
+// AuthzConfig is the policy authorizing the clients to call the methods by the identities of their principals.
+type AuthzConfig struct {
+	// Enabled turns on the authorization, any client with a trusted certificate may call any method otherwise.
+	Enabled bool
+	Groups  []AuthzGroup
+	Rules   []AuthzRule
+}
+
+// AuthzGroup names the group of identities.
+type AuthzGroup struct {
+	Name    string
+	Members []string
+}
+
+// AuthzRule allows the principals to call the methods.
+type AuthzRule struct {
+	// Principals are the identities, 'group:<name>' groups or '*' for any client.
+	Principals []string
+	// Methods are the full method names such as '/shop.v1.ShopService/Remove', '/shop.v1.ShopService/*' for all
+	// the service methods or '*' for any method.
+	Methods []string
+}
+
+// Authorizer checks the client identities against the authorization policy which can be updated at any time.
+type Authorizer struct {
+	policy atomic.Value
+	log    *zap.SugaredLogger
+}
+
+// authzPolicy is the authorization config with the groups resolved to their members.
+type authzPolicy struct {
+	enabled bool
+	rules   []authzRule
+}
+
+type authzRule struct {
+	principals map[string]struct{}
+	methods    []string
+}
+
+// NewAuthorizer returns authorizer enforcing the policy, the policy problems are logged to the logger.
+func NewAuthorizer(cfg AuthzConfig, log *zap.SugaredLogger) *Authorizer {
+	a := &Authorizer{log: log}
+	a.Update(cfg)
+	return a
+}
+
+// Update replaces the authorization policy, the calls in progress are not affected.
+func (a *Authorizer) Update(cfg AuthzConfig) {
+	groups := authzGroups(cfg.Groups)
+	p := &authzPolicy{enabled: cfg.Enabled}
+	for _, r := range cfg.Rules {
+		p.rules = append(p.rules, newAuthzRule(r.Principals, r.Methods, groups, a.log))
+	}
+	a.policy.Store(p)
+}
+
+// authzGroups returns the members of the groups by the group names.
+func authzGroups(cfg []AuthzGroup) map[string][]string {
+	groups := make(map[string][]string, len(cfg))
+	for _, g := range cfg {
+		groups[g.Name] = append(groups[g.Name], g.Members...)
+	}
+	return groups
+}
+
+// newAuthzRule returns the rule matching the principals, with the 'group:<name>' principals resolved to the group
+// members, and the methods. The unknown groups are logged and match no principal.
+func newAuthzRule(principals, methods []string, groups map[string][]string, log *zap.SugaredLogger) authzRule {
+	rule := authzRule{principals: make(map[string]struct{}), methods: methods}
+	for _, principal := range principals {
+		if strings.HasPrefix(principal, groupPrefix) {
+			name := strings.TrimPrefix(principal, groupPrefix)
+			members, ok := groups[name]
+			if !ok {
+				log.Warnf("Rule refers to unknown group '%s'.", name)
+			}
+			for _, m := range members {
+				rule.principals[m] = struct{}{}
+			}
+			continue
+		}
+		rule.principals[principal] = struct{}{}
+	}
+	return rule
+}
+
+// UnaryServerInterceptor returns interceptor rejecting the calls not allowed by the policy with PermissionDenied status.
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor rejecting the calls not allowed by the policy with PermissionDenied status.
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (a *Authorizer) authorize(ctx context.Context, method string) error {
+	p := a.policy.Load().(*authzPolicy)
+	if !p.enabled || isHealthMethod(method) {
+		return nil
+	}
+
+	var identities []string
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		identities = principal.Identities
+	}
+	if p.allows(identities, method) {
+		return nil
+	}
+	logging.FromContext(ctx).Infof("Method '%s' denied to client %v.", method, identities)
+	return status.Errorf(codes.PermissionDenied, "Method '%s' is not allowed.", method)
+}
+
+func (p *authzPolicy) allows(identities []string, method string) bool {
+	for _, r := range p.rules {
+		if r.matchesPrincipal(identities) && r.matchesMethod(method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r authzRule) matchesPrincipal(identities []string) bool {
+	if _, ok := r.principals[anyPrincipal]; ok && len(identities) > 0 {
+		return true
+	}
+	for _, id := range identities {
+		if _, ok := r.principals[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r authzRule) matchesMethod(method string) bool {
+	for _, m := range r.methods {
+		switch {
+		case m == anyMethod, m == method:
+			return true
+		case strings.HasSuffix(m, "/*") && strings.HasPrefix(method, strings.TrimSuffix(m, "*")):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var testAuthzConfig = AuthzConfig{
+	Enabled: true,
+	Groups: []AuthzGroup{
+		{Name: "admins", Members: []string{"cn:admin", "uri:spiffe://shop/admin"}},
+	},
+	Rules: []AuthzRule{
+		{Principals: []string{"group:admins"}, Methods: []string{"*"}},
+		{Principals: []string{"ou:writers"}, Methods: []string{"/shop.v2.ShopService/*"}},
+		{Principals: []string{"*"}, Methods: []string{"/shop.v2.ShopService/Get"}},
+	},
+}
+
+func TestAuthorizer_UnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      AuthzConfig
+		cert     *x509.Certificate
+		method   string
+		wantCode codes.Code
+	}{
+		{
+			name:     "group member by common name",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "admin"}},
+			method:   "/shop.v1.ShopService/Remove",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "group member by URI SAN",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{URIs: []*url.URL{{Scheme: "spiffe", Host: "shop", Path: "/admin"}}},
+			method:   "/shop.v1.ShopService/Remove",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "organizational unit allowed service method",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job", OrganizationalUnit: []string{"writers"}}},
+			method:   "/shop.v2.ShopService/Remove",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "organizational unit method of other service",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "job", OrganizationalUnit: []string{"writers"}}},
+			method:   "/shop.v1.ShopService/Remove",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "any client allowed method",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{DNSNames: []string{"reader.shop"}},
+			method:   "/shop.v2.ShopService/Get",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "any client not allowed method",
+			cfg:      testAuthzConfig,
+			cert:     &x509.Certificate{DNSNames: []string{"reader.shop"}},
+			method:   "/shop.v2.ShopService/Remove",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "no principal",
+			cfg:      testAuthzConfig,
+			method:   "/shop.v2.ShopService/Get",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "authorization disabled",
+			cfg:      AuthzConfig{},
+			method:   "/shop.v1.ShopService/Remove",
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := NewAuthorizer(tt.cfg, zaptest.NewLogger(t).Sugar()).UnaryServerInterceptor()
+
+			_, err := interceptor(principalContext(tt.cert), nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, nil
+				})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestAuthorizer_Update(t *testing.T) {
+	a := NewAuthorizer(AuthzConfig{}, zaptest.NewLogger(t).Sugar())
+	ctx := principalContext(&x509.Certificate{Subject: pkix.Name{CommonName: "job"}})
+
+	assert.NoError(t, a.authorize(ctx, "/shop.v1.ShopService/Remove"))
+
+	a.Update(testAuthzConfig)
+	assert.Equal(t, codes.PermissionDenied, status.Code(a.authorize(ctx, "/shop.v1.ShopService/Remove")))
+}
+
+func principalContext(cert *x509.Certificate) context.Context {
+	ctx := context.Background()
+	if cert == nil {
+		return ctx
+	}
+	p, _ := certPrincipal(peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	}))
+	return context.WithValue(ctx, principalKey{}, p)
+}
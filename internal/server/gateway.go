@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/cert"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const gatewayShutdownTimeout = 5 * time.Second
+
+// GatewayConfig REST/JSON gateway options.
+type GatewayConfig struct {
+	// Enabled serves the REST/JSON API translated to the gRPC calls.
+	Enabled bool
+	Address string
+}
+
+// DefaultGatewayConfig default REST/JSON gateway options.
+var DefaultGatewayConfig = GatewayConfig{
+	Address: "localhost:8444",
+}
+
+// forwardedHeaders are the HTTP request headers passed to the gRPC calls as metadata besides the standard ones.
+var forwardedHeaders = map[string]bool{
+	logging.RequestIDHeader: true,
+	"traceparent":           true,
+	"tracestate":            true,
+}
+
+// Gateway is HTTPS server translating the REST/JSON requests to the gRPC calls of the in-process connection
+// to the gRPC server. The calls are authenticated, authorized and limited the same way as the gRPC calls,
+// the gRPC status codes of the failed calls are translated to HTTP status codes.
+type Gateway struct {
+	Addr       string
+	mux        *runtime.ServeMux
+	conn       *grpc.ClientConn
+	httpServer *http.Server
+	log        *zap.SugaredLogger
+}
+
+// NewGateway returns initialized gateway to the gRPC server using the same TLS config. The gateway is shut down
+// by the graceful shutdown of the server.
+func NewGateway(opts GatewayConfig, tls *tls.Config, s *ShopServer, log *zap.SugaredLogger) (*Gateway, error) {
+	conn, err := s.dialInProcess()
+	if err != nil {
+		return nil, err
+	}
+	g := &Gateway{Addr: opts.Address, conn: conn, log: log}
+	g.mux = runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+		runtime.WithMetadata(clientMetadata),
+	)
+	g.httpServer = &http.Server{
+		Addr:      opts.Address,
+		Handler:   g.mux,
+		TLSConfig: cert.WithNextProtos(tls, http2Proto, http11Proto),
+	}
+	s.gateway = g
+	return g, nil
+}
+
+// Mux returns the multiplexer the REST/JSON handlers of the services are registered in.
+func (g *Gateway) Mux() *runtime.ServeMux {
+	return g.mux
+}
+
+// Conn returns the connection the REST/JSON handlers of the services call the gRPC server with.
+func (g *Gateway) Conn() grpc.ClientConnInterface {
+	return g.conn
+}
+
+// ListenAndServe gateway starts listening on given address including the port.
+func (g *Gateway) ListenAndServe() error {
+	g.log.Infof("Starting REST gateway on address '%s'.", g.Addr)
+	// the certificate and key are provided by the TLS config
+	if err := g.httpServer.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// shutdown gracefully shutdowns the gateway, waiting for the requests in progress.
+func (g *Gateway) shutdown() {
+	g.log.Infof("Shutting down REST gateway on address '%s'.", g.Addr)
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayShutdownTimeout)
+	defer cancel()
+	if err := g.httpServer.Shutdown(ctx); err != nil {
+		g.log.Errorf("Failed to shutdown REST gateway: %v", err)
+	}
+	if err := g.conn.Close(); err != nil {
+		g.log.Errorf("Failed to close REST gateway connection: %v", err)
+	}
+}
+
+// incomingHeaderMatcher passes the forwarded headers and the default ones except the metadata describing
+// the client, which is set only by the gateway.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if forwardedHeaders[strings.ToLower(key)] {
+		return key, true
+	}
+	key, ok := runtime.DefaultHeaderMatcher(key)
+	return key, ok && !isInProcessMetadata(strings.ToLower(key))
+}
+
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == logging.RequestIDHeader {
+		return key, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// clientMetadata passes the client address and TLS connection state to the gRPC calls so the server
+// authenticates the client by its certificate.
+func clientMetadata(_ context.Context, r *http.Request) metadata.MD {
+	return inProcessMetadata(r.RemoteAddr, r.TLS)
+}
+
+// remoteAddr is the address of the HTTP client.
+type remoteAddr string
+
+func (a remoteAddr) Network() string {
+	return "tcp"
+}
+
+func (a remoteAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testItemID = "8f8b6b2e-3c3f-4c46-9d43-6b7c8e0f4a21"
+
+type testShopService struct {
+	proto.UnimplementedShopServiceServer
+}
+
+func (s *testShopService) Get(_ context.Context, req *proto.ItemRequestId) (*proto.Item, error) {
+	if req.GetId() != testItemID {
+		return nil, status.Errorf(codes.NotFound, "Item '%s' not found.", req.GetId())
+	}
+	return &proto.Item{Id: testItemID, Name: "apple", Price: 1.5, Version: 1}, nil
+}
+
+func TestGateway(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	s, err := New(Config{ClientAuth: ClientAuthMTLS, Authz: testAuthzConfig}, &tls.Config{}, nil, logger)
+	require.NoError(t, err)
+	proto.RegisterShopServiceServer(s, &testShopService{})
+	gw, err := NewGateway(GatewayConfig{Address: "localhost:0"}, &tls.Config{}, s, logger.Sugar())
+	require.NoError(t, err)
+	require.NoError(t, proto.RegisterShopServiceHandlerClient(context.Background(), gw.Mux(), proto.NewShopServiceClient(gw.Conn())))
+	go func() { _ = s.grpcServer.Serve(s.inProcess) }()
+	defer s.grpcServer.Stop()
+
+	admin := testClientCert(t, pkix.Name{CommonName: "admin"})
+	writer := testClientCert(t, pkix.Name{CommonName: "job", OrganizationalUnit: []string{"writers"}})
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   http.Header
+		cert     *x509.Certificate
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "item found",
+			method:   http.MethodGet,
+			path:     "/v1/items/" + testItemID,
+			cert:     admin,
+			wantCode: http.StatusOK,
+			wantBody: `"name":"apple"`,
+		},
+		{
+			name:     "item not found",
+			method:   http.MethodGet,
+			path:     "/v1/items/0b7d5b1c-4a5e-4e8f-9a55-7c1f0e2b6d11",
+			cert:     admin,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "method not implemented",
+			method:   http.MethodDelete,
+			path:     "/v1/items/" + testItemID,
+			cert:     admin,
+			wantCode: http.StatusNotImplemented,
+		},
+		{
+			name:     "malformed body",
+			method:   http.MethodPost,
+			path:     "/v1/items",
+			body:     "{",
+			cert:     admin,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "method not allowed to client",
+			method:   http.MethodGet,
+			path:     "/v1/items/" + testItemID,
+			cert:     writer,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "client without certificate",
+			method:   http.MethodGet,
+			path:     "/v1/items/" + testItemID,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "client certificate forged by header",
+			method:   http.MethodGet,
+			path:     "/v1/items/" + testItemID,
+			header:   http.Header{"Grpc-Metadata-" + inProcessClientCertKey: []string{base64.StdEncoding.EncodeToString(admin.Raw)}},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			rec := httptest.NewRecorder()
+
+			gw.httpServer.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantCode != http.StatusBadRequest {
+				// the request ID of the gRPC call is returned unless the request was rejected by the gateway
+				assert.NotEmpty(t, rec.Header().Get(logging.RequestIDHeader))
+			}
+		})
+	}
+}
+
+// testClientCert returns self-signed client certificate of the subject.
+func testClientCert(t *testing.T, subject pkix.Name) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	c, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return c
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/cert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const grpcWebShutdownTimeout = 5 * time.Second
+
+// GrpcWebConfig gRPC-Web options.
+type GrpcWebConfig struct {
+	// Enabled serves the gRPC-Web calls of the browser clients, in both binary and text mode, on the address.
+	Enabled bool
+	Address string
+	// AllowedOrigins are the origins of the browser clients allowed to call the server cross-origin,
+	// '*' allows any origin.
+	AllowedOrigins []string
+}
+
+// DefaultGrpcWebConfig default gRPC-Web options.
+var DefaultGrpcWebConfig = GrpcWebConfig{
+	Address: "localhost:8445",
+}
+
+// grpcWebServer is HTTPS server translating the gRPC-Web calls to the calls of the gRPC server, the calls go through
+// the same interceptors as the gRPC calls.
+type grpcWebServer struct {
+	httpServer *http.Server
+	// calls are the calls in progress, the gRPC server must not be stopped before they finish.
+	calls sync.WaitGroup
+	log   *zap.SugaredLogger
+}
+
+func newGrpcWebServer(opts GrpcWebConfig, tls *tls.Config, s *grpc.Server, log *zap.SugaredLogger) *grpcWebServer {
+	w := &grpcWebServer{log: log}
+	wrapped := grpcweb.WrapServer(s, grpcweb.WithOriginFunc(originAllowed(opts.AllowedOrigins)))
+	w.httpServer = &http.Server{
+		Addr:      opts.Address,
+		TLSConfig: cert.WithNextProtos(tls, http2Proto, http11Proto),
+		Handler: http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			w.calls.Add(1)
+			defer w.calls.Done()
+			wrapped.ServeHTTP(resp, req)
+		}),
+	}
+	return w
+}
+
+// serve serves the gRPC-Web calls on the listener.
+func (w *grpcWebServer) serve(lis net.Listener) error {
+	w.log.Infof("Starting gRPC-Web server on address '%s'.", w.httpServer.Addr)
+	// the certificate and key are provided by the TLS config
+	if err := w.httpServer.ServeTLS(lis, "", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// shutdown gracefully shutdowns the server, the calls still in progress after the timeout are cancelled.
+// It returns once all the calls finish.
+func (w *grpcWebServer) shutdown() {
+	w.log.Infof("Shutting down gRPC-Web server on address '%s'.", w.httpServer.Addr)
+	ctx, cancel := context.WithTimeout(context.Background(), grpcWebShutdownTimeout)
+	defer cancel()
+	if err := w.httpServer.Shutdown(ctx); err != nil {
+		w.log.Warnf("Cancelling gRPC-Web calls in progress: %v", err)
+		_ = w.httpServer.Close()
+	}
+	w.calls.Wait()
+}
+
+// originAllowed returns the function checking the origin is in the allowed origins.
+func originAllowed(allowed []string) func(origin string) bool {
+	return func(origin string) bool {
+		for _, a := range allowed {
+			if a == "*" || a == origin {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc/codes"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func TestGrpcWebServer(t *testing.T) {
+	cfg := Config{
+		ClientAuth: ClientAuthMTLS,
+		Authz:      testAuthzConfig,
+		GrpcWeb:    GrpcWebConfig{Enabled: true, Address: "localhost:0", AllowedOrigins: []string{"https://admin.shop"}},
+	}
+	s, err := New(cfg, &tls.Config{}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	proto.RegisterShopServiceServer(s, &testShopService{})
+
+	msg, err := protobuf.Marshal(&proto.ItemRequestId{Id: testItemID})
+	require.NoError(t, err)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	admin := &x509.Certificate{Subject: pkix.Name{CommonName: "admin"}}
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		cert        *x509.Certificate
+		wantCode    codes.Code
+	}{
+		{
+			name:        "binary mode",
+			contentType: "application/grpc-web+proto",
+			body:        frame,
+			cert:        admin,
+			wantCode:    codes.OK,
+		},
+		{
+			name:        "text mode",
+			contentType: "application/grpc-web-text",
+			body:        []byte(base64.StdEncoding.EncodeToString(frame)),
+			cert:        admin,
+			wantCode:    codes.OK,
+		},
+		{
+			name:        "client without certificate",
+			contentType: "application/grpc-web+proto",
+			body:        frame,
+			wantCode:    codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/shop.v1.ShopService/Get", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert != nil {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			rec := httptest.NewRecorder()
+
+			s.webServer.httpServer.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			// the status of the call without response is in the headers, in the trailer frame of the body otherwise
+			if code := rec.Header().Get("Grpc-Status"); code != "" {
+				assert.Equal(t, strconv.Itoa(int(tt.wantCode)), code)
+				return
+			}
+			body := rec.Body.Bytes()
+			if tt.contentType == "application/grpc-web-text" {
+				// every frame of the response is encoded separately
+				body = decodeGrpcWebText(t, body)
+			}
+			assert.Contains(t, string(body), fmt.Sprintf("grpc-status: %d", tt.wantCode))
+		})
+	}
+}
+
+func TestGrpcWebServer_Cors(t *testing.T) {
+	cfg := Config{GrpcWeb: GrpcWebConfig{Enabled: true, Address: "localhost:0", AllowedOrigins: []string{"https://admin.shop"}}}
+	s, err := New(cfg, &tls.Config{}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	proto.RegisterShopServiceServer(s, &testShopService{})
+
+	tests := []struct {
+		origin    string
+		wantAllow string
+	}{
+		{origin: "https://admin.shop", wantAllow: "https://admin.shop"},
+		{origin: "https://evil.example", wantAllow: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/shop.v1.ShopService/Get", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+			rec := httptest.NewRecorder()
+
+			s.webServer.httpServer.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantAllow, rec.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func decodeGrpcWebText(t *testing.T, body []byte) []byte {
+	var decoded []byte
+	for len(body) > 0 {
+		// frames are padded to the multiple of 4 bytes so the end of the first one is found by the padding
+		n := bytes.IndexByte(body, '=')
+		if n < 0 {
+			n = len(body)
+		}
+		for n < len(body) && body[n] == '=' {
+			n++
+		}
+		n += (4 - n%4) % 4
+		if n > len(body) {
+			n = len(body)
+		}
+		d, err := base64.StdEncoding.DecodeString(string(body[:n]))
+		require.NoError(t, err)
+		decoded = append(decoded, d...)
+		body = body[n:]
+	}
+	return decoded
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// HealthConfig health checking options.
+type HealthConfig struct {
+	// CheckInterval is the period of the dependency checks.
+	CheckInterval time.Duration
+	// ShutdownDelay is the time between reporting NOT_SERVING and stopping the server so the load balancers
+	// stop sending new calls meanwhile.
+	ShutdownDelay time.Duration
+}
+
+// DefaultHealthConfig default health checking options.
+var DefaultHealthConfig = HealthConfig{
+	CheckInterval: 10 * time.Second,
+}
+
+// isHealthMethod returns whether the method is of the gRPC health service. The health service is exempt from
+// the authentication, authorization and rate limits so the probes without credentials get the health status.
+func isHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// HealthCheck returns error when the dependency of the server is not usable.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// Health periodically checks the dependencies of the server and reports the result by the gRPC health service
+// and the HTTP handlers. The services are SERVING when all the checks pass, NOT_SERVING otherwise.
+type Health struct {
+	opts     HealthConfig
+	server   *health.Server
+	log      *zap.SugaredLogger
+	mu       sync.RWMutex
+	checks   []namedCheck
+	services []string
+	// failures are the errors of the failed checks by the check names.
+	failures map[string]string
+	shutdown bool
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewHealth returns health with no checks, the services are SERVING until the checks are run.
+func NewHealth(opts HealthConfig, log *zap.SugaredLogger) *Health {
+	return &Health{
+		opts:     opts,
+		server:   health.NewServer(),
+		log:      log,
+		failures: map[string]string{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// AddCheck adds the named dependency check, it has to be called before the checks are started.
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// addService reports the status of the service too.
+func (h *Health) addService(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.services = append(h.services, name)
+	h.updateLocked()
+}
+
+// start runs the checks and then repeats them periodically until stopped.
+func (h *Health) start() {
+	interval := h.opts.CheckInterval
+	if interval <= 0 {
+		interval = DefaultHealthConfig.CheckInterval
+	}
+
+	h.runChecks()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.runChecks()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *Health) runChecks() {
+	failures := map[string]string{}
+	for _, c := range h.checks {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		if err := c.check(ctx); err != nil {
+			failures[c.name] = err.Error()
+		}
+		cancel()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, err := range failures {
+		if _, ok := h.failures[name]; !ok {
+			h.log.Warnf("Health check '%s' failed: %s", name, err)
+		}
+	}
+	for name := range h.failures {
+		if _, ok := failures[name]; !ok {
+			h.log.Infof("Health check '%s' passed again.", name)
+		}
+	}
+	h.failures = failures
+	h.updateLocked()
+}
+
+func (h *Health) updateLocked() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if len(h.failures) > 0 {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	// the empty service name is the status of the whole server
+	h.server.SetServingStatus("", status)
+	for _, s := range h.services {
+		h.server.SetServingStatus(s, status)
+	}
+}
+
+// Shutdown stops the checks and reports NOT_SERVING for all the services from now on.
+func (h *Health) Shutdown() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shutdown = true
+	h.server.Shutdown()
+}
+
+// LivenessHandler returns HTTP handler responding 200 while the process is alive. The failures of the dependencies
+// are not reported by it so the process isn't restarted because of them, they are reported by the readiness.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler returns HTTP handler responding 200 when all the checks pass and the server is not shutting down,
+// 503 with the failures otherwise.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(h.failures) == 0 && !h.shutdown {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if h.shutdown {
+			fmt.Fprintln(w, "shutting down")
+		}
+		names := make([]string, 0, len(h.failures))
+		for name := range h.failures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s: %s\n", name, h.failures[name])
+		}
+	})
+}
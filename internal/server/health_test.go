@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		name          string
+		checkErr      error
+		shutdown      bool
+		wantStatus    healthpb.HealthCheckResponse_ServingStatus
+		wantLiveness  int
+		wantReadiness int
+	}{
+		{
+			name:          "checks passed",
+			wantStatus:    healthpb.HealthCheckResponse_SERVING,
+			wantLiveness:  http.StatusOK,
+			wantReadiness: http.StatusOK,
+		},
+		{
+			name:          "check failed",
+			checkErr:      errors.New("database unreachable"),
+			wantStatus:    healthpb.HealthCheckResponse_NOT_SERVING,
+			wantLiveness:  http.StatusOK,
+			wantReadiness: http.StatusServiceUnavailable,
+		},
+		{
+			name:          "shutting down",
+			shutdown:      true,
+			wantStatus:    healthpb.HealthCheckResponse_NOT_SERVING,
+			wantLiveness:  http.StatusOK,
+			wantReadiness: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth(DefaultHealthConfig, zaptest.NewLogger(t).Sugar())
+			h.AddCheck("passing", func(context.Context) error { return nil })
+			h.AddCheck("repository", func(context.Context) error { return tt.checkErr })
+			h.addService("shop.v2.ShopService")
+			h.start()
+			if tt.shutdown {
+				h.Shutdown()
+			} else {
+				defer h.Shutdown()
+			}
+
+			for _, service := range []string{"", "shop.v2.ShopService"} {
+				resp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStatus, resp.GetStatus(), service)
+			}
+			liveness := httptest.NewRecorder()
+			h.LivenessHandler().ServeHTTP(liveness, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, tt.wantLiveness, liveness.Code)
+			readiness := httptest.NewRecorder()
+			h.ReadinessHandler().ServeHTTP(readiness, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantReadiness, readiness.Code)
+			if tt.checkErr != nil {
+				assert.Equal(t, "repository: database unreachable\n", readiness.Body.String())
+			}
+		})
+	}
+}
+
+func TestShopServer_HealthWithoutCredentials(t *testing.T) {
+	cfg := Config{
+		ClientAuth: ClientAuthMTLS,
+		Authz:      AuthzConfig{Enabled: true},
+		RateLimit:  RateLimitConfig{Enabled: true, Default: RateLimit{Rate: 0.001, Burst: 1}},
+	}
+	s, err := New(cfg, testServerTLSConfig(t), nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	proto.RegisterShopServiceServer(s, &testShopService{})
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go s.grpcServer.Serve(lis) //nolint:errcheck
+	defer s.grpcServer.Stop()
+
+	creds := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the probes without client certificate are not authenticated, authorized nor rate limited
+	for i := 0; i < 3; i++ {
+		resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+	_, err = proto.NewShopServiceClient(conn).Get(context.Background(), &proto.ItemRequestId{Id: testItemID})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// testServerTLSConfig returns the TLS config of the server with self-signed certificate, verifying the client
+// certificates when given.
+func testServerTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	cas := x509.NewCertPool()
+	cas.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    cas,
+	}
+}
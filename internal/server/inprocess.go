@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// inProcessBufferSize is the size of the buffers of the in-process connections.
+const inProcessBufferSize = 1024 * 1024
+
+// Metadata of the in-process calls describing the client of the gateway, it is trusted only on the in-process
+// connections.
+const (
+	// inProcessClientAddrKey is the address of the gateway client.
+	inProcessClientAddrKey = "x-in-process-client-addr"
+	// inProcessClientCertKey is the DER of the client certificate verified by the gateway.
+	inProcessClientCertKey = "x-in-process-client-cert-bin"
+)
+
+// inProcessListener accepts the connections dialed by the in-process clients of the server.
+type inProcessListener struct {
+	*bufconn.Listener
+}
+
+func newInProcessListener() *inProcessListener {
+	return &inProcessListener{Listener: bufconn.Listen(inProcessBufferSize)}
+}
+
+func (l *inProcessListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &inProcessConn{Conn: c}, nil
+}
+
+// inProcessConn is the server side of the in-process connection, the network connections can't be of this type.
+type inProcessConn struct {
+	net.Conn
+}
+
+// inProcessCredentials skips the TLS handshake of the in-process connections and marks them by their auth info.
+type inProcessCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c inProcessCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(*inProcessConn); ok {
+		return conn, inProcessAuthInfo{}, nil
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c inProcessCredentials) Clone() credentials.TransportCredentials {
+	return inProcessCredentials{TransportCredentials: c.TransportCredentials.Clone()}
+}
+
+// inProcessAuthInfo is the auth info of the in-process connections.
+type inProcessAuthInfo struct{}
+
+func (inProcessAuthInfo) AuthType() string {
+	return "in-process"
+}
+
+// dialInProcess returns the client connection to the server which does not leave the process. The calls are
+// intercepted the same way as the calls received over the network.
+func (s *ShopServer) dialInProcess() (*grpc.ClientConn, error) {
+	conn, err := grpc.Dial("passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.inProcess.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	return conn, errors.Wrap(err, "failed to dial in-process connection")
+}
+
+// inProcessMetadata returns the metadata describing the client of the gateway by its address and TLS connection
+// state.
+func inProcessMetadata(addr string, state *tls.ConnectionState) metadata.MD {
+	md := metadata.Pairs(inProcessClientAddrKey, addr)
+	if state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		md.Set(inProcessClientCertKey, string(state.VerifiedChains[0][0].Raw))
+	}
+	return md
+}
+
+// isInProcessMetadata reports the metadata keys which can be set only by the gateway.
+func isInProcessMetadata(key string) bool {
+	return key == inProcessClientAddrKey || key == inProcessClientCertKey
+}
+
+// inProcessPeer replaces the peer of the in-process calls by the gateway client described by the metadata,
+// so the client is authenticated by its certificate. The peer of the other calls is returned unchanged.
+func inProcessPeer(ctx context.Context) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	if _, ok := p.AuthInfo.(inProcessAuthInfo); !ok {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := &peer.Peer{Addr: p.Addr}
+	if addr := md.Get(inProcessClientAddrKey); len(addr) > 0 {
+		client.Addr = remoteAddr(addr[0])
+	}
+	state := tls.ConnectionState{}
+	if der := md.Get(inProcessClientCertKey); len(der) > 0 {
+		c, err := x509.ParseCertificate([]byte(der[0]))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse in-process client certificate")
+		}
+		state.PeerCertificates = []*x509.Certificate{c}
+		state.VerifiedChains = [][]*x509.Certificate{{c}}
+	}
+	client.AuthInfo = credentials.TLSInfo{
+		State:          state,
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}
+	return peer.NewContext(ctx, client), nil
+}
+
+// inProcessUnaryServerInterceptor returns interceptor replacing the peer of the in-process calls by the gateway client.
+func inProcessUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := inProcessPeer(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// inProcessStreamServerInterceptor returns interceptor replacing the peer of the in-process calls by the gateway client.
+func inProcessStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := inProcessPeer(ss.Context())
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
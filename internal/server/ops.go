@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const opsShutdownTimeout = 5 * time.Second
+
+// OpsConfig ops HTTP server options.
+type OpsConfig struct {
+	Address string
+	// CertFilename and KeyFilename enable TLS when both are set.
+	CertFilename string
+	KeyFilename  string
+}
+
+// DefaultOpsConfig default ops HTTP server options.
+var DefaultOpsConfig = OpsConfig{
+	Address: "localhost:8079",
+}
+
+// OpsServer is HTTP server of the operational endpoints such as Prometheus metrics.
+type OpsServer struct {
+	Addr       string
+	opts       OpsConfig
+	mux        *http.ServeMux
+	httpServer *http.Server
+	log        *zap.SugaredLogger
+}
+
+// NewOps returns initialized ops HTTP server serving the metrics on /metrics path.
+func NewOps(opts OpsConfig, log *zap.SugaredLogger) *OpsServer {
+	s := &OpsServer{Addr: opts.Address, opts: opts, mux: http.NewServeMux(), log: log}
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.httpServer = &http.Server{Addr: opts.Address, Handler: s.mux}
+	return s
+}
+
+// Handle registers the handler of the ops endpoint.
+func (s *OpsServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ListenAndServe ops server starts listening on given address including the port.
+func (s *OpsServer) ListenAndServe() error {
+	var err error
+	if s.opts.CertFilename != "" && s.opts.KeyFilename != "" {
+		s.log.Infof("Starting ops HTTPS server on address '%s'.", s.Addr)
+		err = s.httpServer.ListenAndServeTLS(s.opts.CertFilename, s.opts.KeyFilename)
+	} else {
+		s.log.Infof("Starting ops HTTP server on address '%s'.", s.Addr)
+		err = s.httpServer.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// GracefulShutdown gracefully shutdowns the ops server, waiting for the requests in progress.
+func (s *OpsServer) GracefulShutdown() {
+	s.log.Infof("Shutting down ops server on address '%s'.", s.Addr)
+	ctx, cancel := context.WithTimeout(context.Background(), opsShutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.log.Errorf("Failed to shutdown ops server: %v", err)
+	}
+}
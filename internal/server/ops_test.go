@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOpsServer_Handle(t *testing.T) {
+	s := NewOps(OpsConfig{Address: "localhost:0"}, zaptest.NewLogger(t).Sugar())
+	s.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/metrics", wantCode: http.StatusOK},
+		{path: "/ping", wantCode: http.StatusNoContent},
+		{path: "/unknown", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_server_rate_limited_total",
+	Help: "Total number of RPCs rejected by the rate limit on the server.",
+}, []string{"grpc_service", "grpc_method"})
+
+// bucketsSweepInterval is the minimal interval between the removals of the idle token buckets.
+const bucketsSweepInterval = time.Minute
+
+// RateLimitConfig limits the rate of the calls of every client by token buckets.
+type RateLimitConfig struct {
+	Enabled bool
+	// Default is the limit of the calls of a client to a method when no rule matches.
+	Default RateLimit
+	// Rules are the limits of the specific clients and methods, the first matching rule applies.
+	Rules []RateLimitRule
+}
+
+// RateLimit is the token bucket refilled by Rate tokens per second up to Burst tokens. Zero rate is unlimited,
+// a limited rate requires a positive burst.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitRule limits the calls of the principals to the methods, principals and methods are matched
+// the same way as by the authorization rules, including the groups of the authorization policy.
+type RateLimitRule struct {
+	Principals []string
+	Methods    []string
+	Limit      RateLimit
+}
+
+// RateLimiter limits the rate of the calls per client and method.
+type RateLimiter struct {
+	cfg RateLimitConfig
+	log *zap.SugaredLogger
+
+	mu    sync.Mutex
+	rules []authzRule
+	// buckets are the token buckets by the rule index, client identities and method, the buckets refilled
+	// to the burst are removed as they are the same as the new ones
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	*rate.Limiter
+	lastUsed time.Time
+	// refill is the time the bucket takes to refill from empty to the burst
+	refill time.Duration
+}
+
+type bucketKey struct {
+	rule   int
+	client string
+	method string
+}
+
+// NewRateLimiter returns rate limiter enforcing the limits, the group principals of the rules are resolved
+// by the authorization groups. The rules problems are logged to the logger.
+func NewRateLimiter(cfg RateLimitConfig, groups []AuthzGroup, log *zap.SugaredLogger) (*RateLimiter, error) {
+	if err := cfg.Default.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid default rate limit")
+	}
+	for i, r := range cfg.Rules {
+		if err := r.Limit.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid rate limit of rule %d", i)
+		}
+	}
+
+	l := &RateLimiter{cfg: cfg, log: log, buckets: make(map[bucketKey]*bucket)}
+	l.UpdateGroups(groups)
+	return l, nil
+}
+
+func (r RateLimit) validate() error {
+	if r.Rate < 0 {
+		return errors.Errorf("rate %v is negative", r.Rate)
+	}
+	if r.Rate > 0 && r.Burst < 1 {
+		return errors.Errorf("burst %d of rate %v is not positive", r.Burst, r.Rate)
+	}
+	return nil
+}
+
+// UpdateGroups resolves the group principals of the rules by the changed authorization groups. The token buckets
+// of the rules are kept.
+func (l *RateLimiter) UpdateGroups(groups []AuthzGroup) {
+	resolved := authzGroups(groups)
+	rules := make([]authzRule, 0, len(l.cfg.Rules))
+	for _, r := range l.cfg.Rules {
+		rules = append(rules, newAuthzRule(r.Principals, r.Methods, resolved, l.log))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+}
+
+// UnaryServerInterceptor returns interceptor rejecting the calls exceeding the limit with ResourceExhausted status
+// with RetryInfo details.
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor rejecting the calls exceeding the limit with ResourceExhausted status
+// with RetryInfo details.
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (l *RateLimiter) allow(ctx context.Context, method string) error {
+	if !l.cfg.Enabled || isHealthMethod(method) {
+		return nil
+	}
+
+	var principal Principal
+	if p, ok := PrincipalFromContext(ctx); ok {
+		principal = *p
+	}
+	now := time.Now()
+	bucket := l.bucket(principal, method, now)
+
+	r := bucket.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	if r.OK() && delay == 0 {
+		return nil
+	}
+	r.CancelAt(now)
+
+	service, name := splitMethodName(method)
+	rateLimitedTotal.WithLabelValues(service, name).Inc()
+	logging.FromContext(ctx).Infof("Method '%s' call of client %v rate limited.", method, principal.Identities)
+
+	st, err := status.New(codes.ResourceExhausted, fmt.Sprintf("Rate limit of method '%s' exceeded.", method)).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		return status.Errorf(codes.ResourceExhausted, "Rate limit of method '%s' exceeded.", method)
+	}
+	return st.Err()
+}
+
+// bucket returns the token bucket of the client calls to the method by the first matching rule or the default limit.
+// The idle buckets are removed at most once per sweep interval.
+func (l *RateLimiter) bucket(principal Principal, method string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= bucketsSweepInterval {
+		l.sweepLocked(now)
+	}
+
+	// the identities tell apart the clients with the same or no name, such as the certificates without common name
+	key := bucketKey{rule: -1, client: strings.Join(principal.Identities, "\x00"), method: method}
+	limit := l.cfg.Default
+	for i, r := range l.rules {
+		if r.matchesPrincipal(principal.Identities) && r.matchesMethod(method) {
+			key.rule = i
+			limit = l.cfg.Rules[i].Limit
+			break
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		r := rate.Limit(limit.Rate)
+		var refill time.Duration
+		if limit.Rate == 0 {
+			r = rate.Inf
+		} else {
+			refill = time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+		}
+		b = &bucket{Limiter: rate.NewLimiter(r, limit.Burst), refill: refill}
+		l.buckets[key] = b
+	}
+	b.lastUsed = now
+	return b.Limiter
+}
+
+// sweepLocked removes the buckets which have been refilled to the burst since they were used.
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.lastUsed) >= b.refill {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+// splitMethodName splits the full method name '/package.Service/Method' to the service and method names.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimiter_UnaryServerInterceptor(t *testing.T) {
+	cfg := RateLimitConfig{
+		Enabled: true,
+		Default: RateLimit{Rate: 0.001, Burst: 2},
+		Rules: []RateLimitRule{
+			{Principals: []string{"cn:batch"}, Methods: []string{"/shop.v2.ShopService/*"}, Limit: RateLimit{Rate: 0.001, Burst: 1}},
+			{Principals: []string{"cn:admin"}, Methods: []string{"*"}},
+			{Principals: []string{"group:jobs"}, Methods: []string{"*"}, Limit: RateLimit{Rate: 0.001, Burst: 1}},
+		},
+	}
+	groups := []AuthzGroup{{Name: "jobs", Members: []string{"ou:jobs"}}}
+	batch := &Principal{Name: "batch", Identities: []string{"cn:batch"}}
+	admin := &Principal{Name: "admin", Identities: []string{"cn:admin"}}
+	other := &Principal{Name: "other", Identities: []string{"cn:other"}}
+	job := &Principal{Name: "job", Identities: []string{"cn:job", "ou:jobs"}}
+	noNameWriter := &Principal{Identities: []string{"ou:writers"}}
+	noNameReader := &Principal{Identities: []string{"ou:readers"}}
+
+	type call struct {
+		principal *Principal
+		method    string
+	}
+	tests := []struct {
+		name      string
+		cfg       RateLimitConfig
+		calls     []call
+		wantCodes []codes.Code
+	}{
+		{
+			name:      "default limit",
+			cfg:       cfg,
+			calls:     []call{{other, "/shop.v2.ShopService/Get"}, {other, "/shop.v2.ShopService/Get"}, {other, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:      "limits per client",
+			cfg:       cfg,
+			calls:     []call{{batch, "/shop.v2.ShopService/Get"}, {other, "/shop.v2.ShopService/Get"}, {batch, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:      "limits per client without name",
+			cfg:       cfg,
+			calls:     []call{{noNameWriter, "/shop.v2.ShopService/Get"}, {noNameWriter, "/shop.v2.ShopService/Get"}, {noNameReader, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.OK},
+		},
+		{
+			name:      "limits per method",
+			cfg:       cfg,
+			calls:     []call{{batch, "/shop.v2.ShopService/Get"}, {batch, "/shop.v2.ShopService/ListItems"}, {batch, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:      "rule not matching method",
+			cfg:       cfg,
+			calls:     []call{{batch, "/shop.v1.ShopService/Get"}, {batch, "/shop.v1.ShopService/Get"}, {batch, "/shop.v1.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:      "unlimited rule",
+			cfg:       cfg,
+			calls:     []call{{admin, "/shop.v2.ShopService/Get"}, {admin, "/shop.v2.ShopService/Get"}, {admin, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.OK},
+		},
+		{
+			name:      "group rule",
+			cfg:       cfg,
+			calls:     []call{{job, "/shop.v1.ShopService/Get"}, {job, "/shop.v1.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.ResourceExhausted},
+		},
+		{
+			name:      "rate limit disabled",
+			cfg:       RateLimitConfig{Default: RateLimit{Rate: 0.001, Burst: 1}},
+			calls:     []call{{other, "/shop.v2.ShopService/Get"}, {other, "/shop.v2.ShopService/Get"}},
+			wantCodes: []codes.Code{codes.OK, codes.OK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewRateLimiter(tt.cfg, groups, zaptest.NewLogger(t).Sugar())
+			require.NoError(t, err)
+			interceptor := l.UnaryServerInterceptor()
+
+			for i, c := range tt.calls {
+				ctx := context.WithValue(context.Background(), principalKey{}, c.principal)
+				_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: c.method},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						return nil, nil
+					})
+
+				assert.Equal(t, tt.wantCodes[i], status.Code(err), "call %d", i)
+				if status.Code(err) == codes.ResourceExhausted {
+					details := status.Convert(err).Details()
+					if assert.Len(t, details, 1) {
+						assert.Greater(t, details[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration().Seconds(), float64(0))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiter_UpdateGroups(t *testing.T) {
+	cfg := RateLimitConfig{
+		Enabled: true,
+		Rules:   []RateLimitRule{{Principals: []string{"group:jobs"}, Methods: []string{"*"}, Limit: RateLimit{Rate: 0.001, Burst: 1}}},
+	}
+	l, err := NewRateLimiter(cfg, nil, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), principalKey{}, &Principal{Name: "job", Identities: []string{"ou:jobs"}})
+
+	assert.NoError(t, l.allow(ctx, "/shop.v1.ShopService/Get"))
+	assert.NoError(t, l.allow(ctx, "/shop.v1.ShopService/Get"))
+
+	l.UpdateGroups([]AuthzGroup{{Name: "jobs", Members: []string{"ou:jobs"}}})
+
+	assert.NoError(t, l.allow(ctx, "/shop.v1.ShopService/Get"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(l.allow(ctx, "/shop.v1.ShopService/Get")))
+}
+
+func TestRateLimiter_SweepBuckets(t *testing.T) {
+	cfg := RateLimitConfig{
+		Enabled: true,
+		Default: RateLimit{Rate: 1, Burst: 10},
+		Rules:   []RateLimitRule{{Principals: []string{"ou:jobs"}, Methods: []string{"*"}, Limit: RateLimit{Rate: 0.001, Burst: 1}}},
+	}
+	l, err := NewRateLimiter(cfg, nil, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.bucket(Principal{Identities: []string{fmt.Sprintf("cn:client-%d", i)}}, "/shop.v1.ShopService/Get", start)
+	}
+	job := l.bucket(Principal{Identities: []string{"ou:jobs"}}, "/shop.v1.ShopService/Get", start)
+	require.True(t, job.AllowN(start, 1))
+	require.Len(t, l.buckets, 101)
+
+	// the buckets refilled to the burst are removed, the bucket of the job takes 1000s to refill
+	l.bucket(Principal{Identities: []string{"cn:client-0"}}, "/shop.v1.ShopService/Get", start.Add(bucketsSweepInterval))
+	assert.Len(t, l.buckets, 2)
+	assert.Same(t, job, l.bucket(Principal{Identities: []string{"ou:jobs"}}, "/shop.v1.ShopService/Get", start.Add(bucketsSweepInterval)))
+	assert.False(t, job.AllowN(start.Add(bucketsSweepInterval), 1))
+}
+
+func TestNewRateLimiter_InvalidLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit RateLimit
+	}{
+		{name: "negative rate", limit: RateLimit{Rate: -1, Burst: 1}},
+		{name: "zero burst", limit: RateLimit{Rate: 1}},
+		{name: "negative burst", limit: RateLimit{Rate: 1, Burst: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRateLimiter(RateLimitConfig{Enabled: true, Default: tt.limit}, nil, zaptest.NewLogger(t).Sugar())
+			assert.Error(t, err)
+
+			rules := []RateLimitRule{{Principals: []string{"*"}, Methods: []string{"*"}, Limit: tt.limit}}
+			_, err = NewRateLimiter(RateLimitConfig{Enabled: true, Rules: rules}, nil, zaptest.NewLogger(t).Sugar())
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/twinj/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// IncidentIDTrailer is the trailer with the ID of the incident logged on panic.
+const IncidentIDTrailer = "x-incident-id"
+
+var panicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_server_panics_total",
+	Help: "Total number of panics recovered while handling RPCs on the server.",
+}, []string{"grpc_service", "grpc_method"})
+
+// RecoveryUnaryServerInterceptor returns interceptor converting the handler panics to Internal status.
+func RecoveryUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverFrom(ctx, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamServerInterceptor returns interceptor converting the handler panics to Internal status.
+func RecoveryStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverFrom(ss.Context(), info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recoverFrom logs the panic with the stack and the request ID under a new incident ID which is returned to the client in trailer.
+func recoverFrom(ctx context.Context, method string, p interface{}) error {
+	incidentID := uuid.NewV4().String()
+	logger := logging.FromContext(ctx).With("incident_id", incidentID)
+	logger.Errorf("Method '%s' panicked: %v\n%s", method, p, debug.Stack())
+
+	service, name := splitMethodName(method)
+	panicsTotal.WithLabelValues(service, name).Inc()
+
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(IncidentIDTrailer, incidentID)); err != nil {
+		logger.Debugf("Failed to set incident ID trailer: %v", err)
+	}
+	return status.Errorf(codes.Internal, "Internal error, incident ID '%s'.", incidentID)
+}
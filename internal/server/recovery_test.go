@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// transportStream records the trailer set by the interceptors.
+type transportStream struct {
+	grpc.ServerTransportStream
+	trailer metadata.MD
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+func TestRecoveryUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     grpc.UnaryHandler
+		wantCode    codes.Code
+		wantTrailer bool
+	}{
+		{
+			name: "handler without panic",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.NotFound, "not found")
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "handler panics",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("boom")
+			},
+			wantCode:    codes.Internal,
+			wantTrailer: true,
+		},
+		{
+			name: "handler panics with error",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				var m map[string]int
+				m["boom"]++
+				return nil, nil
+			},
+			wantCode:    codes.Internal,
+			wantTrailer: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &transportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+
+			_, err := RecoveryUnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/shop.v2.ShopService/Get"}, tt.handler)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			incidentIDs := stream.trailer.Get(IncidentIDTrailer)
+			if !tt.wantTrailer {
+				assert.Empty(t, incidentIDs)
+				return
+			}
+			if assert.Len(t, incidentIDs, 1) {
+				assert.True(t, strings.Contains(status.Convert(err).Message(), incidentIDs[0]))
+			}
+		})
+	}
+}
@@ -2,31 +2,49 @@ package server
 
 import (
 	"crypto/tls"
-	log "github.com/sirupsen/logrus"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/cert"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/validation"
 	"net"
 	"time"
 
 	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
-	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
+	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
-	grpcot "github.com/opentracing-contrib/go-grpc"
-	ot "github.com/opentracing/opentracing-go"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
 const maxConnectionAge = 60 * time.Second
 
+// ALPN protocols of the listeners.
+const (
+	http2Proto  = "h2"
+	http11Proto = "http/1.1"
+)
+
 // Config gRPC server options.
 type Config struct {
-	Address              string
-	CertFilename         string
-	KeyFilename          string
-	ClientCACert         string
+	Address      string
+	CertFilename string
+	KeyFilename  string
+	ClientCACert string
+	// ClientAuth is the client authentication mode, 'mtls', 'jwt' or 'mtls_or_jwt'.
+	ClientAuth string
+	// JWT configures the bearer token verification of the 'jwt' and 'mtls_or_jwt' client authentication modes.
+	JWT JWTConfig
+	// ClientCRLs are the optional CRL files of the client CA, clients with revoked certificates are rejected.
+	ClientCRLs           []string
 	ReflectionAPIEnabled bool
-	TraceEnabled         bool
+	Authz                AuthzConfig
+	RateLimit            RateLimitConfig
+	Health               HealthConfig
+	GrpcWeb              GrpcWebConfig
 }
 
 // DefaultConfig default gRPC server options.
@@ -35,41 +53,75 @@ var DefaultConfig = Config{
 	CertFilename:         "test-certs/server-cert.pem",
 	KeyFilename:          "test-certs/server-key.pem",
 	ClientCACert:         "test-certs/ca-cert.pem",
+	ClientAuth:           ClientAuthMTLS,
+	JWT:                  DefaultJWTConfig,
+	Health:               DefaultHealthConfig,
+	GrpcWeb:              DefaultGrpcWebConfig,
 	ReflectionAPIEnabled: true,
-	TraceEnabled:         false,
 }
 
 // ShopServer is server where gRPC services can be registered in.
 type ShopServer struct {
-	Addr       string
-	grpcServer *grpc.Server
+	Addr          string
+	grpcServer    *grpc.Server
+	authz         *Authorizer
+	limiter       *RateLimiter
+	health        *Health
+	shutdownDelay time.Duration
+	log           *zap.SugaredLogger
+	// inProcess accepts the connections of the REST gateway.
+	inProcess *inProcessListener
+	// webServer serves the gRPC-Web calls when enabled.
+	webServer *grpcWebServer
+	// gateway serves the REST/JSON calls when created for the server.
+	gateway *Gateway
 }
 
-// New returns initialized grpc server.
-func New(opts Config, tls *tls.Config) *ShopServer {
+// New returns initialized grpc server logging the calls to the logger. The token verifier is required by the client
+// authentication modes accepting bearer tokens.
+func New(opts Config, tls *tls.Config, token *TokenVerifier, logger *zap.Logger) (*ShopServer, error) {
 	s := new(ShopServer)
 	s.Addr = opts.Address
+	s.log = logger.Sugar()
+	s.shutdownDelay = opts.Health.ShutdownDelay
+	s.inProcess = newInProcessListener()
 
 	grpcprom.EnableHandlingTimeHistogram()
-	logEntry := log.NewEntry(log.New())
+	authn := NewAuthenticator(opts.ClientAuth, token)
+	s.authz = NewAuthorizer(opts.Authz, s.log)
+	limiter, err := NewRateLimiter(opts.RateLimit, opts.Authz.Groups, s.log)
+	if err != nil {
+		return nil, err
+	}
+	s.limiter = limiter
 
+	// the spans are recorded by the global tracer provider
 	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		inProcessUnaryServerInterceptor(),
+		otelgrpc.UnaryServerInterceptor(),
 		grpcprom.UnaryServerInterceptor,
-		grpc_logrus.UnaryServerInterceptor(logEntry),
+		grpc_zap.UnaryServerInterceptor(logger),
+		logging.UnaryServerInterceptor(logger),
+		RecoveryUnaryServerInterceptor(),
+		authn.UnaryServerInterceptor(),
+		s.authz.UnaryServerInterceptor(),
+		s.limiter.UnaryServerInterceptor(),
+		validation.UnaryServerInterceptor(s.log),
 	}
 	streamInterceptors := []grpc.StreamServerInterceptor{
+		inProcessStreamServerInterceptor(),
+		otelgrpc.StreamServerInterceptor(),
 		grpcprom.StreamServerInterceptor,
-		grpc_logrus.StreamServerInterceptor(logEntry),
-	}
-
-	if opts.TraceEnabled {
-		tracer := ot.GlobalTracer()
-		unaryInterceptors = append(unaryInterceptors, grpcot.OpenTracingServerInterceptor(tracer))
-		streamInterceptors = append(streamInterceptors, grpcot.OpenTracingStreamServerInterceptor(tracer))
+		grpc_zap.StreamServerInterceptor(logger),
+		logging.StreamServerInterceptor(logger),
+		RecoveryStreamServerInterceptor(),
+		authn.StreamServerInterceptor(),
+		s.authz.StreamServerInterceptor(),
+		s.limiter.StreamServerInterceptor(),
 	}
 
 	serverOptions := []grpc.ServerOption{
-		grpc.Creds(credentials.NewTLS(tls)),
+		grpc.Creds(inProcessCredentials{TransportCredentials: credentials.NewTLS(cert.WithNextProtos(tls, http2Proto))}),
 		grpc.UnaryInterceptor(grpcmiddleware.ChainUnaryServer(unaryInterceptors...)),
 		grpc.StreamInterceptor(grpcmiddleware.ChainStreamServer(streamInterceptors...)),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
@@ -80,37 +132,76 @@ func New(opts Config, tls *tls.Config) *ShopServer {
 	s.grpcServer = grpc.NewServer(serverOptions...)
 
 	grpcprom.Register(s.grpcServer)
+	if opts.GrpcWeb.Enabled {
+		s.webServer = newGrpcWebServer(opts.GrpcWeb, tls, s.grpcServer, s.log)
+	}
+
+	s.health = NewHealth(opts.Health, s.log)
+	healthpb.RegisterHealthServer(s.grpcServer, s.health.server)
 
 	if opts.ReflectionAPIEnabled {
 		reflection.Register(s.grpcServer)
-		log.Info("Reflection API is active.")
+		s.log.Info("Reflection API is active.")
 	}
 
-	return s
+	return s, nil
 }
 
 // RegisterService implements grpc.ServiceRegistrar interface so internals of this type does not need to be exposed.
+// The health of the service is reported by the health service.
 func (s *ShopServer) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
 	s.grpcServer.RegisterService(desc, impl)
+	s.health.addService(desc.ServiceName)
 }
 
-// ListenAndServe gRPC server starts listening on given address including the port.
+// Health returns the health of the server, the checks of its dependencies are added to it.
+func (s *ShopServer) Health() *Health {
+	return s.health
+}
+
+// UpdateAuthz replaces the authorization policy of the server and the groups of its rate limit rules.
+func (s *ShopServer) UpdateAuthz(cfg AuthzConfig) {
+	s.authz.Update(cfg)
+	s.limiter.UpdateGroups(cfg.Groups)
+}
+
+// ListenAndServe gRPC server starts listening on given address including the port, on the in-process listener
+// of the REST gateway and the gRPC-Web server on its address when enabled.
 func (s *ShopServer) ListenAndServe() error {
-	log.Infof("Starting gRPC server on address '%s'.", s.Addr)
+	s.log.Infof("Starting gRPC server on address '%s'.", s.Addr)
 
 	lis, err := net.Listen("tcp", s.Addr)
 	if err != nil {
 		return err
 	}
-
-	if err := s.grpcServer.Serve(lis); err != nil {
-		return err
+	errs := make(chan error, 3)
+	if s.webServer != nil {
+		webLis, err := net.Listen("tcp", s.webServer.httpServer.Addr)
+		if err != nil {
+			_ = lis.Close()
+			return err
+		}
+		go func() { errs <- s.webServer.serve(webLis) }()
 	}
-	return nil
+	s.health.start()
+
+	go func() { errs <- s.grpcServer.Serve(s.inProcess) }()
+	go func() { errs <- s.grpcServer.Serve(lis) }()
+	return <-errs
 }
 
-// GracefulShutdown gracefully shutdowns the gRPC server.
+// GracefulShutdown reports the server NOT_SERVING, waits for the shutdown delay so the load balancers drain it
+// and gracefully shutdowns the gRPC-Web server, the REST gateway and the gRPC server.
 func (s *ShopServer) GracefulShutdown() {
-	log.Infof("Shutting down gRPC server on address '%s'.", s.Addr)
+	s.log.Infof("Shutting down gRPC server on address '%s'.", s.Addr)
+	s.health.Shutdown()
+	time.Sleep(s.shutdownDelay)
+	// the gRPC server cannot drain the gRPC-Web calls so they have to finish first
+	if s.webServer != nil {
+		s.webServer.shutdown()
+	}
+	if s.gateway != nil {
+		s.gateway.shutdown()
+	}
 	s.grpcServer.GracefulStop()
 }
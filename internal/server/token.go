@@ -0,0 +1,176 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// JWTConfig bearer token verification options.
+type JWTConfig struct {
+	// JWKSFile is the JSON Web Key Set file with the public keys verifying the token signatures.
+	JWKSFile   string
+	Issuer     string
+	Audience   string
+	Algorithms []string
+}
+
+// DefaultJWTConfig default bearer token verification options.
+var DefaultJWTConfig = JWTConfig{
+	Algorithms: []string{"RS256", "ES256"},
+}
+
+// TokenVerifier verifies the JWT bearer tokens signed by the keys of the JWKS.
+type TokenVerifier struct {
+	cfg    JWTConfig
+	keys   map[string]crypto.PublicKey
+	parser *jwt.Parser
+}
+
+// NewTokenVerifier returns verifier of the tokens with the keys loaded from the JWKS file.
+func NewTokenVerifier(cfg JWTConfig) (*TokenVerifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("JWT issuer and audience have to be set")
+	}
+	keys, err := loadJWKS(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenVerifier{
+		cfg:    cfg,
+		keys:   keys,
+		parser: jwt.NewParser(jwt.WithValidMethods(cfg.Algorithms)),
+	}, nil
+}
+
+// Verify checks the token signature, algorithm, issuer, audience and expiry and returns the principal of its subject.
+func (v *TokenVerifier) Verify(token string) (*Principal, error) {
+	var claims jwt.RegisteredClaims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyExpiresAt(now, true):
+		return nil, errors.New("token is expired or has no expiry")
+	case !claims.VerifyIssuer(v.cfg.Issuer, true):
+		return nil, errors.New("unexpected token issuer")
+	case !claims.VerifyAudience(v.cfg.Audience, true):
+		return nil, errors.New("unexpected token audience")
+	case claims.Subject == "":
+		return nil, errors.New("token has no subject")
+	}
+	return &Principal{Name: claims.Subject, Identities: []string{"sub:" + claims.Subject}}, nil
+}
+
+// key returns the JWKS key of the token 'kid' header, the only key may be used by tokens without the header.
+func (v *TokenVerifier) key(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			return k, nil
+		}
+	}
+	k, ok := v.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key ID '%s'", kid)
+	}
+	return k, nil
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS loads the RSA and EC public keys of the JWKS file by their IDs.
+func loadJWKS(file string) (map[string]crypto.PublicKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "JWKS read")
+	}
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "JWKS parse")
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "JWKS key '%s'", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.Errorf("unsupported key type '%s'", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid base64url value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// itemResourceType is the resource type of the items reported in the error details.
+const itemResourceType = "shop.Item"
+
+// itemErr converts the error of the repository operation on the item to gRPC status with the item resource info.
+// The expected version is reported when the item is not in it. Errors already converted to gRPC status are
+// returned unchanged, unexpected errors are reported as internal ones.
+func itemErr(ctx context.Context, err error, id string, expectedVersion int64) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, repository.NotFoundErr):
+		return withDetails(ctx, status.New(codes.NotFound, fmt.Sprintf("Item with id '%s' doesn't exist.", id)),
+			&errdetails.ResourceInfo{ResourceType: itemResourceType, ResourceName: id, Description: "item not found"})
+	case errors.Is(err, repository.VersionMismatchErr):
+		msg := fmt.Sprintf("Item with id '%s' is not in the expected version '%d'.", id, expectedVersion)
+		return withDetails(ctx, status.New(codes.Aborted, msg),
+			&errdetails.ResourceInfo{ResourceType: itemResourceType, ResourceName: id, Description: "item version mismatch"})
+	}
+
+	logging.FromContext(ctx).Errorf("Items repository failure: %v", err)
+	return status.Error(codes.Internal, "Items repository failure.")
+}
+
+// currencyErr returns FailedPrecondition status of the item which price is not in the currency supported by the client.
+func currencyErr(ctx context.Context, id, currency, supported string) error {
+	msg := fmt.Sprintf("Item with id '%s' has price in '%s', only '%s' is supported by this API version.", id, currency, supported)
+	return withDetails(ctx, status.New(codes.FailedPrecondition, msg), &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "CURRENCY",
+			Subject:     itemResourceType + "/" + id,
+			Description: fmt.Sprintf("item price is in '%s'", currency),
+		}},
+	})
+}
+
+// invalidArgumentErr returns InvalidArgument status with the violations of the request fields.
+func invalidArgumentErr(ctx context.Context, violations ...*errdetails.BadRequest_FieldViolation) error {
+	msg := "Invalid request."
+	if len(violations) == 1 {
+		msg = fmt.Sprintf("Invalid %s: %s.", violations[0].GetField(), violations[0].GetDescription())
+	}
+	return withDetails(ctx, status.New(codes.InvalidArgument, msg), &errdetails.BadRequest{FieldViolations: violations})
+}
+
+func fieldViolation(field string, err error) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: err.Error()}
+}
+
+// withDetails returns the status error with the details, the details are dropped if they can't be attached.
+func withDetails(ctx context.Context, st *status.Status, details ...protoiface.MessageV1) error {
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to attach error details: %v", err)
+		return st.Err()
+	}
+	return withDetails.Err()
+}
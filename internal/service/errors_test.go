@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func TestItemErr(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantDetails []interface{}
+	}{
+		{
+			name:     "not found",
+			err:      errors.Wrap(repository.NotFoundErr, "get"),
+			wantCode: codes.NotFound,
+			wantDetails: []interface{}{
+				&errdetails.ResourceInfo{ResourceType: itemResourceType, ResourceName: "id-1", Description: "item not found"},
+			},
+		},
+		{
+			name:     "version mismatch",
+			err:      repository.VersionMismatchErr,
+			wantCode: codes.Aborted,
+			wantDetails: []interface{}{
+				&errdetails.ResourceInfo{ResourceType: itemResourceType, ResourceName: "id-1", Description: "item version mismatch"},
+			},
+		},
+		{
+			name:     "status error",
+			err:      status.Error(codes.InvalidArgument, "invalid"),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unexpected error",
+			err:      errors.New("disk failure"),
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(itemErr(context.Background(), tt.err, "id-1", 2))
+
+			assert.Equal(t, tt.wantCode, st.Code())
+			assertDetails(t, tt.wantDetails, st.Details())
+		})
+	}
+}
+
+func TestInvalidArgumentErr(t *testing.T) {
+	st := status.Convert(invalidArgumentErr(context.Background(),
+		fieldViolation("name", errors.New("must not be empty")),
+		fieldViolation("price", errors.New("must not be negative")),
+	))
+
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assertDetails(t, []interface{}{&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: "name", Description: "must not be empty"},
+		{Field: "price", Description: "must not be negative"},
+	}}}, st.Details())
+}
+
+func assertDetails(t *testing.T, want, got []interface{}) {
+	require.Len(t, got, len(want))
+	for i := range want {
+		assert.True(t, protobuf.Equal(want[i].(protobuf.Message), got[i].(protobuf.Message)), "want %v, got %v", want[i], got[i])
+	}
+}
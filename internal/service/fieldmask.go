@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// applyFieldMask sets the dst fields listed in the mask to the values of the src fields. All the fields
+// except the immutable ones are set when the mask is empty. No field is set if any of the mask paths is
+// unknown or immutable.
+func applyFieldMask(dst, src protobuf.Message, mask *fieldmaskpb.FieldMask, immutable ...string) error {
+	d, s := dst.ProtoReflect(), src.ProtoReflect()
+	isImmutable := func(fd protoreflect.FieldDescriptor) bool {
+		for _, name := range immutable {
+			if string(fd.Name()) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var fields []protoreflect.FieldDescriptor
+	if len(mask.GetPaths()) == 0 {
+		all := d.Descriptor().Fields()
+		for i := 0; i < all.Len(); i++ {
+			if !isImmutable(all.Get(i)) {
+				fields = append(fields, all.Get(i))
+			}
+		}
+	}
+	for _, path := range mask.GetPaths() {
+		fd := d.Descriptor().Fields().ByName(protoreflect.Name(path))
+		if fd == nil {
+			return fmt.Errorf("unknown update mask path '%s'", path)
+		}
+		if isImmutable(fd) {
+			return fmt.Errorf("update mask path '%s' is immutable", path)
+		}
+		fields = append(fields, fd)
+	}
+
+	for _, fd := range fields {
+		if s.Has(fd) {
+			d.Set(fd, s.Get(fd))
+		} else {
+			d.Clear(fd)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+
+	pageTokenPrefix = "after:"
+)
+
+var invalidPageTokenErr = errors.New("invalid page token")
+
+// pageSize returns the number of items to be listed for the requested page size.
+func pageSize(requested int32) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, errors.New("page size must not be negative")
+	case requested == 0:
+		return defaultPageSize, nil
+	case requested > maxPageSize:
+		return maxPageSize, nil
+	}
+	return int(requested), nil
+}
+
+// encodePageToken creates opaque page token pointing after the item with given ID.
+func encodePageToken(lastID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(pageTokenPrefix + lastID))
+}
+
+// decodePageToken returns the item ID cursor the page token points after. Empty token points to the first page.
+func decodePageToken(token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(b), pageTokenPrefix) {
+		return "", invalidPageTokenErr
+	}
+	return strings.TrimPrefix(string(b), pageTokenPrefix), nil
+}
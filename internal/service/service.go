@@ -2,30 +2,34 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"net/http"
+
 	"github.com/golang/protobuf/ptypes/empty"
-	"github.com/pkg/errors"
-	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/money"
 	"github.com/plieskovsky/go-grpc-server-shop/internal/server"
 	"github.com/plieskovsky/go-grpc-server-shop/proto"
-	log "github.com/sirupsen/logrus"
-	"github.com/twinj/uuid"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
 )
 
-// ItemsRepo provides functions to manage Items in repository.
-type ItemsRepo interface {
-	Get(id string) (*proto.Item, error)
-	GetAll() (*proto.ItemsList, error)
-	Upsert(i *proto.Item) (*proto.Item, error)
-	Remove(id string) error
+// Config of the shop services.
+type Config struct {
+	// V1Currency is the currency of the float prices of the v1 API.
+	V1Currency string
+}
+
+// DefaultConfig default shop services options.
+var DefaultConfig = Config{
+	V1Currency: "EUR",
 }
 
-// ShopService provides CRUD on Items.
+// ShopService provides CRUD on Items in v1 API. The item prices are converted from and to the configured
+// currency, the items which prices are in another currency are rejected with FailedPrecondition.
 type ShopService struct {
 	proto.UnimplementedShopServiceServer
-	ItemsRepo ItemsRepo
+	*Shop
+	// Currency of the item prices, prices set by v1 clients are stored in it.
+	Currency string
 }
 
 // Register registers the service to gRPC server.
@@ -33,68 +37,179 @@ func (s *ShopService) Register(server *server.ShopServer) {
 	proto.RegisterShopServiceServer(server, s)
 }
 
-func (s *ShopService) GetAll(_ context.Context, _ *empty.Empty) (*proto.ItemsList, error) {
-	log.Info("Get all items item request.")
+// RegisterGateway registers the REST/JSON handlers of the service and its OpenAPI document to the gateway.
+func (s *ShopService) RegisterGateway(gw *server.Gateway) error {
+	err := proto.RegisterShopServiceHandlerClient(context.Background(), gw.Mux(), proto.NewShopServiceClient(gw.Conn()))
+	if err != nil {
+		return err
+	}
+	return gw.Mux().HandlePath(http.MethodGet, "/v1/openapi.json", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(proto.OpenAPI)
+	})
+}
+
+func (s *ShopService) GetAll(ctx context.Context, _ *empty.Empty) (*proto.ItemsList, error) {
+	logging.FromContext(ctx).Info("Get all items item request.")
 
-	i, err := s.ItemsRepo.GetAll()
+	i, err := s.getAll(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return i, nil
+	v1, err := s.itemsToV1(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.ItemsList{Items: v1}, nil
 }
 
-func (s *ShopService) Get(_ context.Context, id *proto.ItemRequestId) (*proto.Item, error) {
-	log.Infof("Get item request '%+v'.", id)
+func (s *ShopService) ListItems(ctx context.Context, req *proto.ListItemsRequest) (*proto.ListItemsResponse, error) {
+	logging.FromContext(ctx).Infof("List items request '%+v'.", req)
 
-	i, err := s.ItemsRepo.Get(id.GetId())
+	items, next, err := s.list(ctx, req.GetPageSize(), req.GetPageToken())
 	if err != nil {
 		return nil, err
 	}
 
-	return i, nil
+	v1, err := s.itemsToV1(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.ListItemsResponse{Items: v1, NextPageToken: next}, nil
 }
 
-func (s *ShopService) Create(_ context.Context, item *proto.CreateItemRequest) (*proto.Item, error) {
-	log.Infof("Create item request '%+v'.", item)
+func (s *ShopService) Get(ctx context.Context, id *proto.ItemRequestId) (*proto.Item, error) {
+	logging.FromContext(ctx).Infof("Get item request '%+v'.", id)
 
-	uuid := uuid.NewV4().String()
-	i := &proto.Item{
-		Id:    uuid,
-		Name:  item.Name,
-		Price: item.Price,
+	i, err := s.get(ctx, id.GetId())
+	if err != nil {
+		return nil, err
 	}
-	i, err := s.ItemsRepo.Upsert(i)
+
+	return s.itemToV1(ctx, i)
+}
+
+func (s *ShopService) Create(ctx context.Context, item *proto.CreateItemRequest) (*proto.Item, error) {
+	logging.FromContext(ctx).Infof("Create item request '%+v'.", item)
+
+	price, err := s.priceFromV1(ctx, item.GetPrice())
 	if err != nil {
 		return nil, err
 	}
 
-	return i, nil
+	i, err := s.create(ctx, item.GetName(), price)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.itemToV1(ctx, i)
 }
 
-func (s *ShopService) Update(_ context.Context, i *proto.Item) (*proto.Item, error) {
-	log.Infof("Update item request '%+v'.", i)
+func (s *ShopService) Update(ctx context.Context, i *proto.Item) (*proto.Item, error) {
+	logging.FromContext(ctx).Infof("Update item request '%+v'.", i)
 
-	_, err := s.ItemsRepo.Get(i.GetId())
-	if errors.Is(err, repository.NotFoundErr) {
-		return nil, status.Errorf(codes.InvalidArgument, fmt.Sprintf("Item with id '%s' doesn't exist.", i.GetId()))
+	item, err := s.itemFromV1(ctx, i)
+	if err != nil {
+		return nil, err
 	}
 
-	i, err = s.ItemsRepo.Upsert(i)
+	updated, err := s.update(ctx, item, nil, s.Currency)
 	if err != nil {
 		return nil, err
 	}
 
-	return i, nil
+	return s.itemToV1(ctx, updated)
 }
 
-func (s *ShopService) Remove(_ context.Context, id *proto.ItemRequestId) (*empty.Empty, error) {
-	log.Infof("Remove item request '%+v'.", id)
+func (s *ShopService) UpdateItem(ctx context.Context, req *proto.UpdateItemRequest) (*proto.Item, error) {
+	logging.FromContext(ctx).Infof("Update item fields request '%+v'.", req)
 
-	err := s.ItemsRepo.Remove(id.GetId())
+	item, err := s.itemFromV1(ctx, req.GetItem())
 	if err != nil {
 		return nil, err
 	}
 
+	updated, err := s.update(ctx, item, req.GetUpdateMask(), s.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.itemToV1(ctx, updated)
+}
+
+func (s *ShopService) Remove(ctx context.Context, req *proto.RemoveItemRequest) (*empty.Empty, error) {
+	logging.FromContext(ctx).Infof("Remove item request '%+v'.", req)
+
+	if err := s.remove(ctx, req.GetId(), req.GetVersion()); err != nil {
+		return nil, err
+	}
+
 	return &empty.Empty{}, nil
 }
+
+func (s *ShopService) WatchItems(req *proto.WatchItemsRequest, stream proto.ShopService_WatchItemsServer) error {
+	ctx := stream.Context()
+	logging.FromContext(ctx).Infof("Watch items request '%+v'.", req)
+
+	return s.watch(ctx, req.GetStartRevision(), func(e *shopv2.ItemEvent) error {
+		i, err := s.itemToV1(ctx, e.GetItem())
+		if err != nil {
+			return err
+		}
+		return stream.Send(&proto.ItemEvent{
+			Type:     proto.ItemEvent_Type(e.GetType()),
+			Item:     i,
+			Revision: e.GetRevision(),
+		})
+	})
+}
+
+func (s *ShopService) priceFromV1(ctx context.Context, price float32) (*shopv2.Money, error) {
+	m, err := money.FromFloat(price, s.Currency)
+	if err != nil {
+		return nil, invalidArgumentErr(ctx, fieldViolation("price", err))
+	}
+	return m, nil
+}
+
+func (s *ShopService) itemFromV1(ctx context.Context, i *proto.Item) (*shopv2.Item, error) {
+	price, err := s.priceFromV1(ctx, i.GetPrice())
+	if err != nil {
+		return nil, err
+	}
+	return &shopv2.Item{
+		Id:      i.GetId(),
+		Name:    i.GetName(),
+		Price:   price,
+		Version: i.GetVersion(),
+	}, nil
+}
+
+// itemToV1 converts the item to v1 API, the item price has to be in the v1 currency as it can't be represented
+// in another one.
+func (s *ShopService) itemToV1(ctx context.Context, i *shopv2.Item) (*proto.Item, error) {
+	if c := i.GetPrice().GetCurrencyCode(); c != "" && c != s.Currency {
+		return nil, currencyErr(ctx, i.GetId(), c, s.Currency)
+	}
+	return &proto.Item{
+		Id:      i.GetId(),
+		Name:    i.GetName(),
+		Price:   money.ToFloat(i.GetPrice()),
+		Version: i.GetVersion(),
+	}, nil
+}
+
+func (s *ShopService) itemsToV1(ctx context.Context, items []*shopv2.Item) ([]*proto.Item, error) {
+	v1 := make([]*proto.Item, 0, len(items))
+	for _, i := range items {
+		item, err := s.itemToV1(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		v1 = append(v1, item)
+	}
+	return v1, nil
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
 	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"reflect"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"testing"
 )
 
@@ -15,26 +21,44 @@ type repoMock struct {
 	mock.Mock
 }
 
-func (m *repoMock) Get(id string) (*proto.Item, error) {
+func (m *repoMock) Get(_ context.Context, id string) (*shopv2.Item, error) {
 	args := m.Called(id)
-	return args.Get(0).(*proto.Item), args.Error(1)
+	return args.Get(0).(*shopv2.Item), args.Error(1)
 }
 
-func (m *repoMock) GetAll() (*proto.ItemsList, error) {
+func (m *repoMock) GetAll(_ context.Context) ([]*shopv2.Item, error) {
 	args := m.Called()
-	return args.Get(0).(*proto.ItemsList), args.Error(1)
+	return args.Get(0).([]*shopv2.Item), args.Error(1)
 }
 
-func (m *repoMock) Upsert(i *proto.Item) (*proto.Item, error) {
-	args := m.Called(i)
-	return args.Get(0).(*proto.Item), args.Error(1)
+func (m *repoMock) List(_ context.Context, after string, limit int) ([]*shopv2.Item, error) {
+	args := m.Called(after, limit)
+	return args.Get(0).([]*shopv2.Item), args.Error(1)
 }
 
-func (m *repoMock) Remove(id string) error {
-	args := m.Called(id)
+func (m *repoMock) Upsert(_ context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error) {
+	args := m.Called(i, expectedVersion)
+	return args.Get(0).(*shopv2.Item), args.Error(1)
+}
+
+func (m *repoMock) Remove(_ context.Context, id string, expectedVersion int64) error {
+	args := m.Called(id, expectedVersion)
 	return args.Error(0)
 }
 
+// protoEq matches the mock argument equal to the expected proto message.
+func protoEq(want protobuf.Message) interface{} {
+	return mock.MatchedBy(func(got protobuf.Message) bool { return protobuf.Equal(want, got) })
+}
+
+func eur(units int64, nanos int32) *shopv2.Money {
+	return &shopv2.Money{CurrencyCode: "EUR", Units: units, Nanos: nanos}
+}
+
+func newShopService(r ItemsRepo) *ShopService {
+	return &ShopService{Shop: &Shop{ItemsRepo: r}, Currency: "EUR"}
+}
+
 var i1 = proto.Item{
 	Id:    "id-1",
 	Name:  "name-1",
@@ -45,10 +69,20 @@ var i2 = proto.Item{
 	Name:  "name-2",
 	Price: 2.2,
 }
+var i1v2 = shopv2.Item{
+	Id:    "id-1",
+	Name:  "name-1",
+	Price: eur(1, 100000000),
+}
+var i2v2 = shopv2.Item{
+	Id:    "id-2",
+	Name:  "name-2",
+	Price: eur(2, 200000000),
+}
 
 func TestShopService_GetAll(t *testing.T) {
 	type repoResponse struct {
-		items *proto.ItemsList
+		items []*shopv2.Item
 		err   error
 	}
 	tests := []struct {
@@ -60,7 +94,7 @@ func TestShopService_GetAll(t *testing.T) {
 		{
 			name: "repository returns items",
 			repoResponse: repoResponse{
-				items: &proto.ItemsList{Items: []*proto.Item{&i1, &i2}},
+				items: []*shopv2.Item{&i1v2, &i2v2},
 				err:   nil,
 			},
 			want: &proto.ItemsList{Items: []*proto.Item{&i1, &i2}},
@@ -77,14 +111,435 @@ func TestShopService_GetAll(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := new(repoMock)
 			r.On("GetAll").Return(tt.repoResponse.items, tt.repoResponse.err)
-			s := &ShopService{ItemsRepo: r}
+			s := newShopService(r)
 
 			got, err := s.GetAll(context.Background(), &empty.Empty{})
 
 			assert.Equal(t, tt.wantErr, err != nil)
 			if !tt.wantErr {
-				assert.True(t, reflect.DeepEqual(tt.want.Items, got.Items))
+				assert.True(t, protobuf.Equal(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestShopService_ListItems(t *testing.T) {
+	i3 := proto.Item{Id: "id-3", Name: "name-3", Price: 3.3}
+	i3v2 := shopv2.Item{Id: "id-3", Name: "name-3", Price: eur(3, 300000000)}
+	type repoCall struct {
+		after string
+		limit int
+		items []*shopv2.Item
+		err   error
+	}
+	tests := []struct {
+		name     string
+		req      *proto.ListItemsRequest
+		repoCall *repoCall
+		want     *proto.ListItemsResponse
+		wantErr  bool
+	}{
+		{
+			name:     "last page",
+			req:      &proto.ListItemsRequest{PageSize: 5},
+			repoCall: &repoCall{limit: 6, items: []*shopv2.Item{&i1v2, &i2v2}},
+			want:     &proto.ListItemsResponse{Items: []*proto.Item{&i1, &i2}},
+		},
+		{
+			name:     "page with next page token",
+			req:      &proto.ListItemsRequest{PageSize: 2},
+			repoCall: &repoCall{limit: 3, items: []*shopv2.Item{&i1v2, &i2v2, &i3v2}},
+			want: &proto.ListItemsResponse{
+				Items:         []*proto.Item{&i1, &i2},
+				NextPageToken: encodePageToken("id-2"),
+			},
+		},
+		{
+			name:     "next page with default page size",
+			req:      &proto.ListItemsRequest{PageToken: encodePageToken("id-2")},
+			repoCall: &repoCall{after: "id-2", limit: defaultPageSize + 1, items: []*shopv2.Item{&i3v2}},
+			want:     &proto.ListItemsResponse{Items: []*proto.Item{&i3}},
+		},
+		{
+			name:    "invalid page token",
+			req:     &proto.ListItemsRequest{PageToken: "id-2"},
+			wantErr: true,
+		},
+		{
+			name:    "negative page size",
+			req:     &proto.ListItemsRequest{PageSize: -1},
+			wantErr: true,
+		},
+		{
+			name:     "repository returns error",
+			req:      &proto.ListItemsRequest{PageSize: 1},
+			repoCall: &repoCall{limit: 2, err: errors.New("repo error")},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			if tt.repoCall != nil {
+				r.On("List", tt.repoCall.after, tt.repoCall.limit).Return(tt.repoCall.items, tt.repoCall.err)
+			}
+			s := newShopService(r)
+
+			got, err := s.ListItems(context.Background(), tt.req)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.True(t, protobuf.Equal(tt.want, got))
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShopService_Get(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   *shopv2.Item
+		getErr   error
+		want     *proto.Item
+		wantCode codes.Code
+	}{
+		{
+			name:   "existing item",
+			stored: &i1v2,
+			want:   &i1,
+		},
+		{
+			name:     "item priced in another currency",
+			stored:   &shopv2.Item{Id: "id-1", Name: "name-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 1}},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "non existing item",
+			getErr:   repository.NotFoundErr,
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			r.On("Get", "id-1").Return(tt.stored, tt.getErr)
+			s := newShopService(r)
+
+			got, err := s.Get(context.Background(), &proto.ItemRequestId{Id: "id-1"})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.True(t, protobuf.Equal(tt.want, got))
+			}
+		})
+	}
+}
+
+func TestShopService_Create(t *testing.T) {
+	r := new(repoMock)
+	stored := &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(100, 150000000), Version: 1}
+	matchesItem := mock.MatchedBy(func(i *shopv2.Item) bool {
+		return i.GetId() != "" && i.GetName() == "name-1" && protobuf.Equal(eur(100, 150000000), i.GetPrice())
+	})
+	r.On("Upsert", matchesItem, int64(0)).Return(stored, nil)
+	s := newShopService(r)
+
+	got, err := s.Create(context.Background(), &proto.CreateItemRequest{Name: "name-1", Price: 100.15})
+
+	assert.NoError(t, err)
+	assert.True(t, protobuf.Equal(&proto.Item{Id: "id-1", Name: "name-1", Price: 100.15, Version: 1}, got))
+	r.AssertExpectations(t)
+}
+
+func TestShopService_UpdateItem(t *testing.T) {
+	stored := func() *shopv2.Item {
+		return &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 100000000), Version: 3}
+	}
+	tests := []struct {
+		name      string
+		req       *proto.UpdateItemRequest
+		getErr    error
+		upsertErr error
+		want      *shopv2.Item
+		wantCode  codes.Code
+	}{
+		{
+			name: "update price only",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Name: "ignored", Price: 5.5},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			want: &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name: "clear name",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1"},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "empty mask updates all fields",
+			req: &proto.UpdateItemRequest{
+				Item: &proto.Item{Id: "id-1", Name: "updated-1", Price: 5.5},
+			},
+			want: &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name: "matching version",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Price: 5.5, Version: 3},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			want: &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(5, 500000000), Version: 3},
+		},
+		{
+			name: "not matching version",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Price: 5.5, Version: 2},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			wantCode: codes.Aborted,
+		},
+		{
+			name: "item changed concurrently",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Price: 5.5},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			want:      &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(5, 500000000), Version: 3},
+			upsertErr: repository.VersionMismatchErr,
+			wantCode:  codes.Aborted,
+		},
+		{
+			name: "unknown path",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Price: 5.5},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price", "color"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "immutable path",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Version: 3},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"version"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "non existing item",
+			req: &proto.UpdateItemRequest{
+				Item:       &proto.Item{Id: "id-1", Price: 5.5},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			getErr:   repository.NotFoundErr,
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			current := stored()
+			if tt.getErr != nil {
+				current = nil
+			}
+			r.On("Get", tt.req.GetItem().GetId()).Return(current, tt.getErr)
+			if tt.want != nil {
+				r.On("Upsert", protoEq(tt.want), int64(3)).Return(tt.want, tt.upsertErr)
+			}
+			s := newShopService(r)
+
+			got, err := s.UpdateItem(context.Background(), tt.req)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				want, err := s.itemToV1(context.Background(), tt.want)
+				assert.NoError(t, err)
+				assert.True(t, protobuf.Equal(want, got))
+			}
+			if current != nil {
+				assert.True(t, protobuf.Equal(stored(), current), "stored item must not be modified")
+			}
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShopService_Update(t *testing.T) {
+	tests := []struct {
+		name            string
+		item            *proto.Item
+		stored          *shopv2.Item
+		getErr          error
+		want            *shopv2.Item
+		expectedVersion int64
+		upsertErr       error
+		wantCode        codes.Code
+	}{
+		{
+			name:            "update without version",
+			item:            &proto.Item{Id: "id-1", Name: "updated-1", Price: 2},
+			stored:          &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 2},
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(2, 0), Version: 2},
+			expectedVersion: 2,
+		},
+		{
+			name:            "update with version",
+			item:            &proto.Item{Id: "id-1", Name: "updated-1", Price: 2, Version: 2},
+			stored:          &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 2},
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(2, 0), Version: 2},
+			expectedVersion: 2,
+		},
+		{
+			name:     "update with not matching version",
+			item:     &proto.Item{Id: "id-1", Name: "updated-1", Price: 2, Version: 1},
+			stored:   &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 2},
+			wantCode: codes.Aborted,
+		},
+		{
+			name:            "update of concurrently changed item",
+			item:            &proto.Item{Id: "id-1", Name: "updated-1", Price: 2},
+			stored:          &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 2},
+			want:            &shopv2.Item{Id: "id-1", Name: "updated-1", Price: eur(2, 0), Version: 2},
+			expectedVersion: 2,
+			upsertErr:       repository.VersionMismatchErr,
+			wantCode:        codes.Aborted,
+		},
+		{
+			name:     "update with empty name",
+			item:     &proto.Item{Id: "id-1", Price: 2},
+			stored:   &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 2},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "update of item priced in another currency",
+			item:     &proto.Item{Id: "id-1", Name: "updated-1", Price: 2},
+			stored:   &shopv2.Item{Id: "id-1", Name: "name-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 1}, Version: 2},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "update non existing item",
+			item:     &proto.Item{Id: "id-1", Name: "updated-1"},
+			getErr:   repository.NotFoundErr,
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			r.On("Get", tt.item.GetId()).Return(tt.stored, tt.getErr)
+			if tt.want != nil {
+				r.On("Upsert", protoEq(tt.want), tt.expectedVersion).Return(tt.want, tt.upsertErr)
 			}
+			s := newShopService(r)
+
+			_, err := s.Update(context.Background(), tt.item)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShopService_Remove(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       *proto.RemoveItemRequest
+		removeErr error
+		wantCode  codes.Code
+	}{
+		{
+			name: "remove without version",
+			req:  &proto.RemoveItemRequest{Id: "id-1"},
+		},
+		{
+			name: "remove with version",
+			req:  &proto.RemoveItemRequest{Id: "id-1", Version: 2},
+		},
+		{
+			name:      "remove with not matching version",
+			req:       &proto.RemoveItemRequest{Id: "id-1", Version: 2},
+			removeErr: repository.VersionMismatchErr,
+			wantCode:  codes.Aborted,
+		},
+		{
+			name:      "remove non existing item",
+			req:       &proto.RemoveItemRequest{Id: "id-1"},
+			removeErr: repository.NotFoundErr,
+			wantCode:  codes.NotFound,
+		},
+		{
+			name:      "repository failure",
+			req:       &proto.RemoveItemRequest{Id: "id-1"},
+			removeErr: errors.New("disk failure"),
+			wantCode:  codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			r.On("Remove", tt.req.GetId(), tt.req.GetVersion()).Return(tt.removeErr)
+			s := newShopService(r)
+
+			_, err := s.Remove(context.Background(), tt.req)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+type watchItemsStream struct {
+	proto.ShopService_WatchItemsServer
+	ctx context.Context
+}
+
+func (s *watchItemsStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestShopService_WatchItems(t *testing.T) {
+	tests := []struct {
+		name string
+		// startRevision is relative to the last published revision
+		startRevision int64
+		otherServer   bool
+		wantCode      codes.Code
+	}{
+		{
+			name:          "resume from compacted revision",
+			startRevision: -1,
+			wantCode:      codes.OutOfRange,
+		},
+		{
+			name:          "resume from future revision",
+			startRevision: 2,
+			wantCode:      codes.OutOfRange,
+		},
+		{
+			name:          "resume from revision of another server",
+			startRevision: 0,
+			otherServer:   true,
+			wantCode:      codes.OutOfRange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newShopService(new(repoMock))
+			s.Events = watch.NewHub(watch.Config{HistorySize: 1})
+			s.Events.Publish(shopv2.ItemEvent_CREATED, &i1v2)
+			last := s.Events.Publish(shopv2.ItemEvent_CREATED, &i2v2)
+			if tt.otherServer {
+				last = watch.NewHub(watch.Config{}).Publish(shopv2.ItemEvent_CREATED, &i1v2)
+			}
+
+			startRevision := last.GetRevision() + tt.startRevision
+			err := s.WatchItems(&proto.WatchItemsRequest{StartRevision: startRevision}, &watchItemsStream{ctx: context.Background()})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
 		})
 	}
 }
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/server"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+)
+
+// ShopServiceV2 provides CRUD on Items in v2 API with exact prices in any ISO 4217 currency.
+type ShopServiceV2 struct {
+	shopv2.UnimplementedShopServiceServer
+	*Shop
+}
+
+// Register registers the service to gRPC server.
+func (s *ShopServiceV2) Register(server *server.ShopServer) {
+	shopv2.RegisterShopServiceServer(server, s)
+}
+
+func (s *ShopServiceV2) ListItems(ctx context.Context, req *shopv2.ListItemsRequest) (*shopv2.ListItemsResponse, error) {
+	logging.FromContext(ctx).Infof("List items request '%+v'.", req)
+
+	items, next, err := s.list(ctx, req.GetPageSize(), req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	return &shopv2.ListItemsResponse{Items: items, NextPageToken: next}, nil
+}
+
+func (s *ShopServiceV2) Get(ctx context.Context, req *shopv2.GetItemRequest) (*shopv2.Item, error) {
+	logging.FromContext(ctx).Infof("Get item request '%+v'.", req)
+
+	return s.get(ctx, req.GetId())
+}
+
+func (s *ShopServiceV2) Create(ctx context.Context, req *shopv2.CreateItemRequest) (*shopv2.Item, error) {
+	logging.FromContext(ctx).Infof("Create item request '%+v'.", req)
+
+	return s.create(ctx, req.GetName(), req.GetPrice())
+}
+
+func (s *ShopServiceV2) Update(ctx context.Context, req *shopv2.UpdateItemRequest) (*shopv2.Item, error) {
+	logging.FromContext(ctx).Infof("Update item request '%+v'.", req)
+
+	return s.update(ctx, req.GetItem(), req.GetUpdateMask(), "")
+}
+
+func (s *ShopServiceV2) Remove(ctx context.Context, req *shopv2.RemoveItemRequest) (*empty.Empty, error) {
+	logging.FromContext(ctx).Infof("Remove item request '%+v'.", req)
+
+	if err := s.remove(ctx, req.GetId(), req.GetVersion()); err != nil {
+		return nil, err
+	}
+
+	return &empty.Empty{}, nil
+}
+
+func (s *ShopServiceV2) WatchItems(req *shopv2.WatchItemsRequest, stream shopv2.ShopService_WatchItemsServer) error {
+	ctx := stream.Context()
+	logging.FromContext(ctx).Infof("Watch items request '%+v'.", req)
+
+	return s.watch(ctx, req.GetStartRevision(), stream.Send)
+}
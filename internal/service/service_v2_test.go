@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestShopServiceV2_Create(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *shopv2.CreateItemRequest
+		wantCode codes.Code
+	}{
+		{
+			name: "valid price",
+			req:  &shopv2.CreateItemRequest{Name: "name-1", Price: &shopv2.Money{CurrencyCode: "CZK", Units: 100, Nanos: 150000000}},
+		},
+		{
+			name:     "price not set",
+			req:      &shopv2.CreateItemRequest{Name: "name-1"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unknown currency",
+			req:      &shopv2.CreateItemRequest{Name: "name-1", Price: &shopv2.Money{CurrencyCode: "ABC", Units: 1}},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			if tt.wantCode == codes.OK {
+				r.On("Upsert", mock.Anything, int64(0)).Return(&shopv2.Item{Id: "id-1"}, nil)
+			}
+			s := &ShopServiceV2{Shop: &Shop{ItemsRepo: r}}
+
+			_, err := s.Create(context.Background(), tt.req)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShopServiceV2_Update(t *testing.T) {
+	stored := &shopv2.Item{Id: "id-1", Name: "name-1", Price: eur(1, 0), Version: 1}
+	tests := []struct {
+		name     string
+		req      *shopv2.UpdateItemRequest
+		want     *shopv2.Item
+		wantCode codes.Code
+	}{
+		{
+			name: "update currency",
+			req: &shopv2.UpdateItemRequest{
+				Item:       &shopv2.Item{Id: "id-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 2}},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			want: &shopv2.Item{Id: "id-1", Name: "name-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 2}, Version: 1},
+		},
+		{
+			name: "invalid price",
+			req: &shopv2.UpdateItemRequest{
+				Item:       &shopv2.Item{Id: "id-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 2, Nanos: -1}},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "clear name",
+			req: &shopv2.UpdateItemRequest{
+				Item:       &shopv2.Item{Id: "id-1", Price: eur(2, 0)},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "price"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "update with empty name",
+			req:      &shopv2.UpdateItemRequest{Item: &shopv2.Item{Id: "id-1", Price: eur(2, 0)}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "clear price",
+			req: &shopv2.UpdateItemRequest{
+				Item:       &shopv2.Item{Id: "id-1"},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"price"}},
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			r.On("Get", "id-1").Return(stored, nil)
+			if tt.want != nil {
+				r.On("Upsert", protoEq(tt.want), int64(1)).Return(tt.want, nil)
+			}
+			s := &ShopServiceV2{Shop: &Shop{ItemsRepo: r}}
+
+			_, err := s.Update(context.Background(), tt.req)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			r.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShopServiceV2_ItemInAnotherCurrencyThroughV1(t *testing.T) {
+	r := require.New(t)
+	shop := &Shop{ItemsRepo: repository.NewInMemoryRepo()}
+	v1 := &ShopService{Shop: shop, Currency: "EUR"}
+	v2 := &ShopServiceV2{Shop: shop}
+	ctx := context.Background()
+
+	created, err := v2.Create(ctx, &shopv2.CreateItemRequest{Name: "name-1", Price: &shopv2.Money{CurrencyCode: "USD", Units: 2}})
+	r.NoError(err)
+
+	_, err = v1.Get(ctx, &proto.ItemRequestId{Id: created.GetId()})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = v1.GetAll(ctx, &empty.Empty{})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = v1.Update(ctx, &proto.Item{Id: created.GetId(), Name: "name-2", Price: 2})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+	_, err = v1.UpdateItem(ctx, &proto.UpdateItemRequest{
+		Item:       &proto.Item{Id: created.GetId(), Name: "name-2"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	stored, err := v2.Get(ctx, &shopv2.GetItemRequest{Id: created.GetId()})
+	r.NoError(err)
+	r.True(protobuf.Equal(created, stored), "item must not be changed through v1")
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/money"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/twinj/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// ItemsRepo provides functions to manage Items in repository.
+type ItemsRepo interface {
+	Get(ctx context.Context, id string) (*shopv2.Item, error)
+	GetAll(ctx context.Context) ([]*shopv2.Item, error)
+	// List returns at most limit items with ID greater than the after cursor, ordered by ID.
+	List(ctx context.Context, after string, limit int) ([]*shopv2.Item, error)
+	// Upsert stores the item with the next version. Non-zero expected version has to match the stored item version.
+	Upsert(ctx context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error)
+	// Remove removes the item. Non-zero expected version has to match the stored item version.
+	Remove(ctx context.Context, id string, expectedVersion int64) error
+}
+
+// emptyNameErr is the violation of the item without name.
+var emptyNameErr = errors.New("must not be empty")
+
+// Shop implements the operations on items shared by all the API versions.
+type Shop struct {
+	ItemsRepo ItemsRepo
+	// Events receives events about items changes, watching of the items is disabled when not set.
+	Events *watch.Hub
+
+	// itemLocks serialize the changes of every item so its events are published in the same order, the changes
+	// of different items run concurrently so the repository can make them durable together.
+	itemLocks itemLocks
+}
+
+// itemLocks are the locks of the items by their IDs, kept only while in use.
+type itemLocks struct {
+	mu    sync.Mutex
+	locks map[string]*itemLock
+}
+
+type itemLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the item and returns the function unlocking it.
+func (l *itemLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*itemLock)
+	}
+	il, ok := l.locks[id]
+	if !ok {
+		il = &itemLock{}
+		l.locks[id] = il
+	}
+	il.refs++
+	l.mu.Unlock()
+
+	il.Lock()
+	return func() {
+		il.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if il.refs--; il.refs == 0 {
+			delete(l.locks, id)
+		}
+	}
+}
+
+func (s *Shop) getAll(ctx context.Context) ([]*shopv2.Item, error) {
+	items, err := s.ItemsRepo.GetAll(ctx)
+	if err != nil {
+		return nil, itemErr(ctx, err, "", 0)
+	}
+	return items, nil
+}
+
+func (s *Shop) get(ctx context.Context, id string) (*shopv2.Item, error) {
+	i, err := s.ItemsRepo.Get(ctx, id)
+	if err != nil {
+		return nil, itemErr(ctx, err, id, 0)
+	}
+	return i, nil
+}
+
+// list returns the page of items and the token of the next page.
+func (s *Shop) list(ctx context.Context, requestedSize int32, pageToken string) ([]*shopv2.Item, string, error) {
+	size, err := pageSize(requestedSize)
+	if err != nil {
+		return nil, "", invalidArgumentErr(ctx, fieldViolation("page_size", err))
+	}
+	after, err := decodePageToken(pageToken)
+	if err != nil {
+		return nil, "", invalidArgumentErr(ctx, fieldViolation("page_token", err))
+	}
+
+	// one more item is requested to find out whether there is a next page
+	items, err := s.ItemsRepo.List(ctx, after, size+1)
+	if err != nil {
+		return nil, "", itemErr(ctx, err, "", 0)
+	}
+
+	if len(items) > size {
+		items = items[:size]
+		return items, encodePageToken(items[size-1].GetId()), nil
+	}
+	return items, "", nil
+}
+
+func (s *Shop) create(ctx context.Context, name string, price *shopv2.Money) (*shopv2.Item, error) {
+	if err := money.Validate(price); err != nil {
+		return nil, invalidArgumentErr(ctx, fieldViolation("price", err))
+	}
+
+	uuid := uuid.NewV4().String()
+	i := &shopv2.Item{
+		Id:    uuid,
+		Name:  name,
+		Price: price,
+	}
+
+	// the item is locked so its changes made once it is readable are published after its creation
+	defer s.itemLocks.lock(uuid)()
+
+	i, err := s.ItemsRepo.Upsert(ctx, i, 0)
+	if err != nil {
+		return nil, itemErr(ctx, err, uuid, 0)
+	}
+	s.publish(shopv2.ItemEvent_CREATED, i)
+
+	return i, nil
+}
+
+// update sets the item fields listed in the mask, all the mutable fields are set when the mask is empty.
+// Non-zero item version has to match the version of the stored item. Non-empty currency has to match
+// the currency of the stored item price, so the clients limited to single currency can't change the currency.
+func (s *Shop) update(ctx context.Context, item *shopv2.Item, mask *fieldmaskpb.FieldMask, currency string) (*shopv2.Item, error) {
+	defer s.itemLocks.lock(item.GetId())()
+
+	current, err := s.ItemsRepo.Get(ctx, item.GetId())
+	if err != nil {
+		return nil, itemErr(ctx, err, item.GetId(), item.GetVersion())
+	}
+
+	expectedVersion := current.GetVersion()
+	if v := item.GetVersion(); v != 0 && v != expectedVersion {
+		return nil, itemErr(ctx, repository.VersionMismatchErr, current.GetId(), v)
+	}
+	if c := current.GetPrice().GetCurrencyCode(); currency != "" && c != "" && c != currency {
+		return nil, currencyErr(ctx, current.GetId(), c, currency)
+	}
+
+	// repository may return the stored item itself so it must not be modified in place
+	i := protobuf.Clone(current).(*shopv2.Item)
+	if err := applyFieldMask(i, item, mask, "id", "version"); err != nil {
+		return nil, invalidArgumentErr(ctx, fieldViolation("update_mask", err))
+	}
+	// the fields are validated by their rules only when set, so the required ones are checked after the merge
+	if i.GetName() == "" {
+		return nil, invalidArgumentErr(ctx, fieldViolation("item.name", emptyNameErr))
+	}
+	if err := money.Validate(i.GetPrice()); err != nil {
+		return nil, invalidArgumentErr(ctx, fieldViolation("item.price", err))
+	}
+
+	updated, err := s.ItemsRepo.Upsert(ctx, i, expectedVersion)
+	if err != nil {
+		return nil, itemErr(ctx, err, i.GetId(), expectedVersion)
+	}
+	s.publish(shopv2.ItemEvent_UPDATED, updated)
+
+	return updated, nil
+}
+
+// remove removes the existing item, non-zero version has to match the version of the stored item.
+func (s *Shop) remove(ctx context.Context, id string, version int64) error {
+	defer s.itemLocks.lock(id)()
+
+	err := s.ItemsRepo.Remove(ctx, id, version)
+	if err != nil {
+		return itemErr(ctx, err, id, version)
+	}
+	s.publish(shopv2.ItemEvent_DELETED, &shopv2.Item{Id: id})
+
+	return nil
+}
+
+// watch sends the items events until the context is done or sending fails.
+func (s *Shop) watch(ctx context.Context, startRevision int64, send func(*shopv2.ItemEvent) error) error {
+	if s.Events == nil {
+		return status.Error(codes.Unimplemented, "Items watching is not enabled.")
+	}
+
+	sub, err := s.Events.Subscribe(startRevision)
+	if errors.Is(err, watch.CompactedErr) {
+		return status.Errorf(codes.OutOfRange, "Revision '%d' is no longer available, items have to be listed again.", startRevision)
+	}
+	if errors.Is(err, watch.FutureRevisionErr) {
+		return status.Errorf(codes.OutOfRange, "Revision '%d' has not been published yet, items have to be listed again.", startRevision)
+	}
+	if errors.Is(err, watch.EpochErr) {
+		return status.Errorf(codes.OutOfRange, "Revision '%d' has been published by another server, items have to be listed again.", startRevision)
+	}
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case e, ok := <-sub.Events():
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "Watching stopped: %v.", sub.Err())
+			}
+			if err := send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// publish sends event about the item change if watching is enabled.
+func (s *Shop) publish(t shopv2.ItemEvent_Type, i *shopv2.Item) {
+	if s.Events != nil {
+		s.Events.Publish(t, i)
+	}
+}
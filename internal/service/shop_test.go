@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/watch"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestShop_BatchDurability(t *testing.T) {
+	const (
+		writers       = 20
+		batchInterval = 200 * time.Millisecond
+	)
+	r := require.New(t)
+	repo, err := repository.OpenInMemoryRepo(repository.MemoryConfig{
+		Dir:              t.TempDir(),
+		Durability:       repository.DurabilityBatch,
+		BatchInterval:    batchInterval,
+		SnapshotInterval: time.Hour,
+	}, zaptest.NewLogger(t).Sugar())
+	r.NoError(err)
+	defer repo.Close()
+	s := &Shop{ItemsRepo: repo, Events: watch.NewHub(watch.DefaultConfig)}
+	sub, err := s.Events.Subscribe(0)
+	r.NoError(err)
+	defer sub.Close()
+
+	// the concurrent creations are made durable together instead of waiting a batch interval one after another
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.create(context.Background(), "name-1", eur(1, 0))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	r.Less(time.Since(start), writers*batchInterval/2)
+
+	// the concurrent updates of the item are published in the order of its versions
+	item := (<-sub.Events()).GetItem()
+	for i := 1; i < writers; i++ {
+		<-sub.Events()
+	}
+	const updates = 3
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.update(context.Background(), &shopv2.Item{Id: item.GetId(), Name: "name-2", Price: eur(2, 0)}, nil, "")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < updates; i++ {
+		e := <-sub.Events()
+		r.Equal(item.GetId(), e.GetItem().GetId())
+		r.Equal(int64(i+2), e.GetItem().GetVersion())
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/plieskovsky/go-grpc-server-shop/internal/service"
+
+// item attributes of the repository spans
+const (
+	itemIDKey      = attribute.Key("shop.item.id")
+	itemVersionKey = attribute.Key("shop.item.version")
+	itemCountKey   = attribute.Key("shop.item.count")
+)
+
+// tracedItemsRepo records span of every call of the repository with the global tracer provider.
+type tracedItemsRepo struct {
+	repo   ItemsRepo
+	tracer trace.Tracer
+}
+
+// NewTracedItemsRepo returns repository recording the spans of the calls of the repository r.
+func NewTracedItemsRepo(r ItemsRepo) ItemsRepo {
+	return &tracedItemsRepo{repo: r, tracer: otel.Tracer(tracerName)}
+}
+
+func (r *tracedItemsRepo) Get(ctx context.Context, id string) (*shopv2.Item, error) {
+	ctx, span := r.start(ctx, "ItemsRepo.Get", itemIDKey.String(id))
+	i, err := r.repo.Get(ctx, id)
+	end(span, err)
+	return i, err
+}
+
+func (r *tracedItemsRepo) GetAll(ctx context.Context) ([]*shopv2.Item, error) {
+	ctx, span := r.start(ctx, "ItemsRepo.GetAll")
+	items, err := r.repo.GetAll(ctx)
+	span.SetAttributes(itemCountKey.Int(len(items)))
+	end(span, err)
+	return items, err
+}
+
+func (r *tracedItemsRepo) List(ctx context.Context, after string, limit int) ([]*shopv2.Item, error) {
+	ctx, span := r.start(ctx, "ItemsRepo.List", attribute.String("shop.list.after", after),
+		attribute.Int("shop.list.limit", limit))
+	items, err := r.repo.List(ctx, after, limit)
+	span.SetAttributes(itemCountKey.Int(len(items)))
+	end(span, err)
+	return items, err
+}
+
+func (r *tracedItemsRepo) Upsert(ctx context.Context, i *shopv2.Item, expectedVersion int64) (*shopv2.Item, error) {
+	ctx, span := r.start(ctx, "ItemsRepo.Upsert", itemIDKey.String(i.GetId()), itemVersionKey.Int64(expectedVersion))
+	stored, err := r.repo.Upsert(ctx, i, expectedVersion)
+	end(span, err)
+	return stored, err
+}
+
+func (r *tracedItemsRepo) Remove(ctx context.Context, id string, expectedVersion int64) error {
+	ctx, span := r.start(ctx, "ItemsRepo.Remove", itemIDKey.String(id), itemVersionKey.Int64(expectedVersion))
+	err := r.repo.Remove(ctx, id, expectedVersion)
+	end(span, err)
+	return err
+}
+
+func (r *tracedItemsRepo) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+}
+
+// end ends the span, the errors other than the expected outcomes of the item operations mark the span as failed.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, repository.NotFoundErr) && !errors.Is(err, repository.VersionMismatchErr) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedItemsRepo_Remove(t *testing.T) {
+	tests := []struct {
+		name       string
+		removeErr  error
+		wantStatus codes.Code
+		wantEvents int
+	}{
+		{
+			name:       "removed item",
+			wantStatus: codes.Unset,
+		},
+		{
+			name:       "non existing item",
+			removeErr:  repository.NotFoundErr,
+			wantStatus: codes.Unset,
+			wantEvents: 1,
+		},
+		{
+			name:       "repository failure",
+			removeErr:  errors.New("disk failure"),
+			wantStatus: codes.Error,
+			wantEvents: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(repoMock)
+			r.On("Remove", "id-1", int64(2)).Return(tt.removeErr)
+			recorder := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			traced := &tracedItemsRepo{repo: r, tracer: tp.Tracer("test")}
+
+			err := traced.Remove(context.Background(), "id-1", 2)
+
+			assert.Equal(t, tt.removeErr, err)
+			r.AssertExpectations(t)
+			spans := recorder.Ended()
+			if assert.Len(t, spans, 1) {
+				assert.Equal(t, "ItemsRepo.Remove", spans[0].Name())
+				assert.Contains(t, spans[0].Attributes(), attribute.String("shop.item.id", "id-1"))
+				assert.Equal(t, tt.wantStatus, spans[0].Status().Code)
+				assert.Len(t, spans[0].Events(), tt.wantEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// span exporters
+const (
+	// NoneExporter disables the tracing.
+	NoneExporter = "none"
+	// OTLPExporter sends the spans to the collector over OTLP/gRPC.
+	OTLPExporter = "otlp"
+	// StdoutExporter writes the spans to stdout.
+	StdoutExporter = "stdout"
+	// FileExporter writes the spans to the file, one JSON span per line.
+	FileExporter = "file"
+)
+
+// Config of the tracing.
+type Config struct {
+	// Exporter is 'none', 'otlp', 'stdout' or 'file'.
+	Exporter string
+	OTLP     OTLPConfig
+	// File is the path of the 'file' exporter, the spans are appended to it.
+	File string
+	// SamplingRatio is the ratio of the traces started by the server which are sampled, from 0 to 1.
+	// The traces started by the clients are sampled as the clients decided.
+	SamplingRatio float64
+	// ResourceAttributes are added to the service name attribute of all the spans.
+	ResourceAttributes []Attribute
+}
+
+// OTLPConfig of the OTLP/gRPC exporter.
+type OTLPConfig struct {
+	// Endpoint is the host and port of the collector.
+	Endpoint string
+	// Insecure disables TLS of the connection to the collector.
+	Insecure bool
+}
+
+// Attribute is the resource attribute.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// DefaultConfig default tracing options.
+var DefaultConfig = Config{
+	Exporter:      NoneExporter,
+	OTLP:          OTLPConfig{Endpoint: "localhost:4317"},
+	File:          "traces.jsonl",
+	SamplingRatio: 1,
+}
+
+// Setup installs the global tracer provider exporting the spans of the service and the W3C trace context
+// propagator. The returned function flushes the spans and shuts the provider down.
+func Setup(cfg Config, serviceName string) (func(context.Context) error, error) {
+	if cfg.Exporter == NoneExporter {
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.SamplingRatio < 0 || cfg.SamplingRatio > 1 {
+		return nil, errors.Errorf("sampling ratio %v out of range 0 to 1", cfg.SamplingRatio)
+	}
+
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := []attribute.KeyValue{semconv.ServiceName(serviceName)}
+	for _, a := range cfg.ResourceAttributes {
+		attrs = append(attrs, attribute.String(a.Key, a.Value))
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attrs...)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+func newExporter(cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case OTLPExporter:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLP.Endpoint)}
+		if cfg.OTLP.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		// the connection is established in background so the server starts even when the collector is down
+		e, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create OTLP exporter")
+		}
+		return e, nil
+	case StdoutExporter:
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create stdout exporter")
+		}
+		return e, nil
+	case FileExporter:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open traces file")
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to create file exporter")
+		}
+		return &closingExporter{SpanExporter: e, closer: f}, nil
+	}
+	return nil, errors.Errorf("unknown tracing exporter '%s'", cfg.Exporter)
+}
+
+// closingExporter closes the writer of the exporter on shutdown.
+type closingExporter struct {
+	sdktrace.SpanExporter
+	closer io.Closer
+}
+
+func (e *closingExporter) Shutdown(ctx context.Context) error {
+	if err := e.SpanExporter.Shutdown(ctx); err != nil {
+		return err
+	}
+	return e.closer.Close()
+}
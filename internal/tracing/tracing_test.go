@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{
+			name: "disabled",
+			cfg:  Config{Exporter: NoneExporter},
+		},
+		{
+			name: "otlp exporter",
+			cfg:  Config{Exporter: OTLPExporter, OTLP: OTLPConfig{Endpoint: "localhost:4317", Insecure: true}, SamplingRatio: 1},
+		},
+		{
+			name:    "unknown exporter",
+			cfg:     Config{Exporter: "zipkin", SamplingRatio: 1},
+			wantErr: true,
+		},
+		{
+			name:    "sampling ratio out of range",
+			cfg:     Config{Exporter: StdoutExporter, SamplingRatio: 1.5},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(tt.cfg, "test")
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.NoError(t, shutdown(context.Background()))
+			}
+		})
+	}
+}
+
+// jsonAttribute is the attribute written by the file exporter.
+type jsonAttribute struct {
+	Key   string
+	Value struct{ Value interface{} }
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	r := require.New(t)
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(Config{
+		Exporter:           FileExporter,
+		File:               file,
+		SamplingRatio:      1,
+		ResourceAttributes: []Attribute{{Key: "deployment.environment", Value: "test"}},
+	}, "shop")
+	r.NoError(err)
+
+	tracer := otel.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	parent.End()
+	r.NoError(shutdown(context.Background()))
+
+	f, err := os.Open(file)
+	r.NoError(err)
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span struct {
+			Name        string
+			SpanContext struct{ TraceID string }
+			Resource    []jsonAttribute
+		}
+		r.NoError(json.Unmarshal(scanner.Bytes(), &span))
+		names = append(names, span.Name)
+		r.Equal(parent.SpanContext().TraceID().String(), span.SpanContext.TraceID)
+		want := jsonAttribute{Key: "deployment.environment"}
+		want.Value.Value = "test"
+		r.Contains(span.Resource, want)
+	}
+	r.NoError(scanner.Err())
+	r.Equal([]string{"child", "parent"}, names)
+	r.True(trace.SpanContextFromContext(ctx).IsSampled())
+}
@@ -0,0 +1,151 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/plieskovsky/go-grpc-server-shop/proto/validate"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// patterns caches the compiled patterns of the string rules.
+var patterns sync.Map
+
+// UnaryServerInterceptor returns interceptor rejecting the requests which violate the rules of their fields
+// with InvalidArgument status listing all the violations. Invalid rules are logged to the logger.
+func UnaryServerInterceptor(log *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if m, ok := req.(proto.Message); ok {
+			if violations := Validate(m, log); len(violations) > 0 {
+				return nil, invalidArgumentErr(violations, log)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Validate checks the message fields, including the fields of the nested messages, against their rules
+// and returns all the violations. Invalid rules are logged to the logger and skipped.
+func Validate(m proto.Message, log *zap.SugaredLogger) []*errdetails.BadRequest_FieldViolation {
+	return validateMessage(m.ProtoReflect(), "", log)
+}
+
+func validateMessage(m protoreflect.Message, prefix string, log *zap.SugaredLogger) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+
+		if r, ok := proto.GetExtension(fd.Options(), validate.E_Rules).(*validate.FieldRules); ok && r != nil {
+			for _, desc := range checkField(r, fd, m.Get(fd), log) {
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: path, Description: desc})
+			}
+		}
+
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() && m.Has(fd) {
+			violations = append(violations, validateMessage(m.Get(fd).Message(), path+".", log)...)
+		}
+	}
+	return violations
+}
+
+// checkField returns the descriptions of the rules violated by the field value.
+func checkField(r *validate.FieldRules, fd protoreflect.FieldDescriptor, v protoreflect.Value, log *zap.SugaredLogger) []string {
+	var failed []string
+	switch {
+	case r.GetString_() != nil && fd.Kind() == protoreflect.StringKind:
+		failed = checkString(r.GetString_(), v.String(), log)
+	case r.GetFloat() != nil && fd.Kind() == protoreflect.FloatKind:
+		failed = checkFloat(r.GetFloat(), float32(v.Float()))
+	case r.GetMoney() != nil && fd.Kind() == protoreflect.MessageKind:
+		failed = checkMoney(r.GetMoney(), v.Message())
+	}
+	return failed
+}
+
+func checkString(r *validate.StringRules, s string, log *zap.SugaredLogger) []string {
+	var failed []string
+	length := uint32(utf8.RuneCountInString(s))
+	if length < r.GetMinLen() {
+		failed = append(failed, fmt.Sprintf("must be at least %d characters long", r.GetMinLen()))
+	}
+	if r.GetMaxLen() > 0 && length > r.GetMaxLen() {
+		failed = append(failed, fmt.Sprintf("must be at most %d characters long", r.GetMaxLen()))
+	}
+	if r.GetPattern() != "" {
+		if p, err := pattern(r.GetPattern()); err != nil {
+			log.Errorf("Invalid validation pattern '%s': %v", r.GetPattern(), err)
+		} else if !p.MatchString(s) {
+			failed = append(failed, fmt.Sprintf("must match pattern '%s'", r.GetPattern()))
+		}
+	}
+	if r.GetUuid() && !uuidPattern.MatchString(s) {
+		failed = append(failed, "must be UUID")
+	}
+	return failed
+}
+
+func checkFloat(r *validate.FloatRules, f float32) []string {
+	var failed []string
+	if r.GetNonNegative() && f < 0 {
+		failed = append(failed, "must not be negative")
+	}
+	if r.GetMax() > 0 && f > r.GetMax() {
+		failed = append(failed, fmt.Sprintf("must be at most %v", r.GetMax()))
+	}
+	return failed
+}
+
+// checkMoney checks the amount of the message having units and nanos fields of google.type.Money.
+func checkMoney(r *validate.MoneyRules, m protoreflect.Message) []string {
+	units, nanos := int64(0), int64(0)
+	if fd := m.Descriptor().Fields().ByName("units"); fd != nil {
+		units = m.Get(fd).Int()
+	}
+	if fd := m.Descriptor().Fields().ByName("nanos"); fd != nil {
+		nanos = m.Get(fd).Int()
+	}
+
+	var failed []string
+	if r.GetNonNegative() && (units < 0 || nanos < 0) {
+		failed = append(failed, "must not be negative")
+	}
+	if r.GetMaxUnits() > 0 && (units > r.GetMaxUnits() || units == r.GetMaxUnits() && nanos > 0) {
+		failed = append(failed, fmt.Sprintf("must be at most %d", r.GetMaxUnits()))
+	}
+	return failed
+}
+
+func pattern(expr string) (*regexp.Regexp, error) {
+	if p, ok := patterns.Load(expr); ok {
+		return p.(*regexp.Regexp), nil
+	}
+	p, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, p)
+	return p, nil
+}
+
+func invalidArgumentErr(violations []*errdetails.BadRequest_FieldViolation, log *zap.SugaredLogger) error {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("Request violates %d validation rule(s).", len(violations)))
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		log.Errorf("Failed to attach error details: %v", err)
+		return st.Err()
+	}
+	return withDetails.Err()
+}
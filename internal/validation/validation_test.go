@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/plieskovsky/go-grpc-server-shop/proto"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const itemID = "2b9d3c52-6a8e-4bf7-9c71-0f3c1f8f5b1e"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		m          protobuf.Message
+		wantFields []string
+	}{
+		{
+			name: "valid create request",
+			m:    &proto.CreateItemRequest{Name: "Čaj (green) 100g", Price: 100.15},
+		},
+		{
+			name:       "empty name",
+			m:          &proto.CreateItemRequest{Price: 1},
+			wantFields: []string{"name"},
+		},
+		{
+			name:       "too long name with invalid characters and negative price",
+			m:          &proto.CreateItemRequest{Name: strings.Repeat("<", 201), Price: -1},
+			wantFields: []string{"name", "name", "price"},
+		},
+		{
+			name:       "price above max",
+			m:          &proto.CreateItemRequest{Name: "name", Price: 1000001},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "id not UUID",
+			m:          &proto.ItemRequestId{Id: "id-1"},
+			wantFields: []string{"id"},
+		},
+		{
+			name: "valid partial update",
+			m:    &proto.UpdateItemRequest{Item: &proto.Item{Id: itemID, Price: 2}},
+		},
+		{
+			name:       "nested item violations",
+			m:          &proto.UpdateItemRequest{Item: &proto.Item{Id: "id-1", Name: "name\n"}},
+			wantFields: []string{"item.id", "item.name"},
+		},
+		{
+			name: "valid v2 create request",
+			m:    &shopv2.CreateItemRequest{Name: "name", Price: &shopv2.Money{CurrencyCode: "EUR", Units: 1000000}},
+		},
+		{
+			name:       "negative v2 price",
+			m:          &shopv2.CreateItemRequest{Name: "name", Price: &shopv2.Money{CurrencyCode: "EUR", Nanos: -1}},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "v2 price above max",
+			m:          &shopv2.CreateItemRequest{Name: "name", Price: &shopv2.Money{CurrencyCode: "EUR", Units: 1000000, Nanos: 1}},
+			wantFields: []string{"price"},
+		},
+		{
+			name:       "v2 remove request id not UUID",
+			m:          &shopv2.RemoveItemRequest{Id: "id-1"},
+			wantFields: []string{"id"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range Validate(tt.m, zaptest.NewLogger(t).Sugar()) {
+				got = append(got, v.GetField())
+			}
+
+			assert.Equal(t, tt.wantFields, got)
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &proto.Item{}, nil
+	}
+	interceptor := UnaryServerInterceptor(zaptest.NewLogger(t).Sugar())
+
+	_, err := interceptor(context.Background(), &proto.ItemRequestId{Id: itemID}, nil, handler)
+	assert.NoError(t, err)
+
+	_, err = interceptor(context.Background(), &proto.CreateItemRequest{Price: -1}, nil, handler)
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	assert.Len(t, st.Details()[0].(*errdetails.BadRequest).GetFieldViolations(), 2)
+}
@@ -0,0 +1,182 @@
+package watch
+
+import (
+	"crypto/rand"
+	"math/big"
+	"sync"
+
+	"github.com/pkg/errors"
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+)
+
+var (
+	// CompactedErr is returned when the requested start revision is no longer kept in the history.
+	CompactedErr = errors.New("requested revision has been compacted")
+	// FutureRevisionErr is returned when the requested start revision is greater than the revision following
+	// the last published one.
+	FutureRevisionErr = errors.New("requested revision has not been published yet")
+	// EpochErr is returned when the requested start revision has been published by another hub, e.g. before
+	// the restart of the server or by another replica.
+	EpochErr = errors.New("requested revision has been published by another server")
+	// SlowConsumerErr is returned by the subscription which has been closed because its buffer was full.
+	SlowConsumerErr = errors.New("subscriber is too slow to consume events")
+)
+
+// sequenceBits is the number of the low revision bits holding the sequence number of the event, the upper bits
+// hold the epoch of the hub so revisions of different hubs do not overlap.
+const sequenceBits = 40
+
+const sequenceMask = 1<<sequenceBits - 1
+
+// Config of the items events hub.
+type Config struct {
+	// HistorySize is the number of the last events kept for resuming the subscriptions.
+	HistorySize int
+	// BufferSize is the number of events buffered for each subscription before it is considered too slow.
+	BufferSize int
+}
+
+// DefaultConfig default items events hub options.
+var DefaultConfig = Config{
+	HistorySize: 1000,
+	BufferSize:  100,
+}
+
+// Hub distributes items events to the subscriptions and keeps a bounded history of them.
+type Hub struct {
+	mu            sync.Mutex
+	bufferSize    int
+	epoch         int64
+	revision      int64
+	history       []*shopv2.ItemEvent
+	subscriptions map[*Subscription]struct{}
+}
+
+// NewHub creates a new hub with no events published.
+func NewHub(cfg Config) *Hub {
+	if cfg.HistorySize < 1 {
+		cfg.HistorySize = DefaultConfig.HistorySize
+	}
+	if cfg.BufferSize < 1 {
+		cfg.BufferSize = DefaultConfig.BufferSize
+	}
+	return &Hub{
+		bufferSize:    cfg.BufferSize,
+		epoch:         newEpoch(),
+		history:       make([]*shopv2.ItemEvent, cfg.HistorySize),
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next revision to the event about the item and sends it to all the subscriptions.
+// Subscriptions which buffer is full are closed with SlowConsumerErr.
+func (h *Hub) Publish(t shopv2.ItemEvent_Type, item *shopv2.Item) *shopv2.ItemEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.revision++
+	e := &shopv2.ItemEvent{Type: t, Item: item, Revision: h.epoch<<sequenceBits | h.revision}
+	h.history[h.revision%int64(len(h.history))] = e
+
+	for s := range h.subscriptions {
+		if h.revision < s.start {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			h.closeLocked(s, SlowConsumerErr)
+		}
+	}
+	return e
+}
+
+// Subscribe creates a subscription to events with revision equal or greater than start revision.
+// Only new events are sent when start revision is not positive. The start revision can be at most the revision
+// following the last published one and it has to be published by this hub.
+func (h *Hub) Subscribe(startRevision int64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if startRevision < 1 {
+		startRevision = h.revision + 1
+	} else if startRevision>>sequenceBits != h.epoch {
+		return nil, EpochErr
+	} else {
+		startRevision &= sequenceMask
+	}
+	if startRevision < h.oldestRevision() {
+		return nil, CompactedErr
+	}
+	if startRevision > h.revision+1 {
+		return nil, FutureRevisionErr
+	}
+
+	var backlog []*shopv2.ItemEvent
+	for r := startRevision; r <= h.revision; r++ {
+		backlog = append(backlog, h.history[r%int64(len(h.history))])
+	}
+
+	s := &Subscription{
+		hub:    h,
+		start:  startRevision,
+		events: make(chan *shopv2.ItemEvent, len(backlog)+h.bufferSize),
+	}
+	for _, e := range backlog {
+		s.events <- e
+	}
+	h.subscriptions[s] = struct{}{}
+	return s, nil
+}
+
+// newEpoch returns random non-zero epoch which keeps the revisions positive.
+func newEpoch() int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(1<<(63-sequenceBits)-1))
+	if err != nil {
+		panic(errors.Wrap(err, "failed to generate hub epoch"))
+	}
+	return n.Int64() + 1
+}
+
+func (h *Hub) oldestRevision() int64 {
+	if oldest := h.revision - int64(len(h.history)) + 1; oldest > 1 {
+		return oldest
+	}
+	return 1
+}
+
+func (h *Hub) closeLocked(s *Subscription, err error) {
+	if _, ok := h.subscriptions[s]; !ok {
+		return
+	}
+	delete(h.subscriptions, s)
+	s.err = err
+	close(s.events)
+}
+
+// Subscription receives events published in the hub.
+type Subscription struct {
+	hub    *Hub
+	start  int64
+	events chan *shopv2.ItemEvent
+	err    error
+}
+
+// Events returns channel of the events. The channel is closed when the subscription is closed.
+func (s *Subscription) Events() <-chan *shopv2.ItemEvent {
+	return s.events
+}
+
+// Err returns the reason the subscription was closed by the hub, it has to be called after events channel is closed.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.closeLocked(s, nil)
+}
@@ -0,0 +1,139 @@
+package watch
+
+import (
+	"testing"
+
+	shopv2 "github.com/plieskovsky/go-grpc-server-shop/proto/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_Subscribe(t *testing.T) {
+	tests := []struct {
+		name          string
+		published     int
+		startRevision int64
+		otherEpoch    bool
+		wantRevisions []int64
+		wantErr       error
+	}{
+		{
+			name:          "only new events",
+			published:     3,
+			startRevision: 0,
+			wantRevisions: []int64{4, 5},
+		},
+		{
+			name:          "resume from revision in history",
+			published:     3,
+			startRevision: 2,
+			wantRevisions: []int64{2, 3, 4, 5},
+		},
+		{
+			name:          "resume from next revision",
+			published:     3,
+			startRevision: 4,
+			wantRevisions: []int64{4, 5},
+		},
+		{
+			name:          "resume from future revision",
+			published:     3,
+			startRevision: 5,
+			wantErr:       FutureRevisionErr,
+		},
+		{
+			name:          "resume from oldest revision in history",
+			published:     6,
+			startRevision: 3,
+			wantRevisions: []int64{3, 4, 5, 6, 7, 8},
+		},
+		{
+			name:          "resume from compacted revision",
+			published:     6,
+			startRevision: 2,
+			wantErr:       CompactedErr,
+		},
+		{
+			name:          "resume from revision of another hub",
+			published:     3,
+			startRevision: 2,
+			otherEpoch:    true,
+			wantErr:       EpochErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+			h := NewHub(Config{HistorySize: 4, BufferSize: 10})
+			for i := 0; i < tt.published; i++ {
+				h.Publish(shopv2.ItemEvent_CREATED, &shopv2.Item{Id: "id-1"})
+			}
+
+			other := NewHub(Config{})
+			other.epoch = h.epoch + 1
+			rev := func(hub *Hub, sequence int64) int64 {
+				return hub.epoch<<sequenceBits | sequence
+			}
+
+			startRevision := tt.startRevision
+			if startRevision > 0 && tt.otherEpoch {
+				startRevision = rev(other, startRevision)
+			} else if startRevision > 0 {
+				startRevision = rev(h, startRevision)
+			}
+			s, err := h.Subscribe(startRevision)
+			if tt.wantErr != nil {
+				r.ErrorIs(err, tt.wantErr)
+				return
+			}
+			r.NoError(err)
+			h.Publish(shopv2.ItemEvent_UPDATED, &shopv2.Item{Id: "id-1"})
+			h.Publish(shopv2.ItemEvent_DELETED, &shopv2.Item{Id: "id-1"})
+			s.Close()
+
+			var got []int64
+			for e := range s.Events() {
+				got = append(got, e.GetRevision()-rev(h, 0))
+			}
+			r.Equal(tt.wantRevisions, got)
+			r.NoError(s.Err())
+		})
+	}
+}
+
+func TestHub_SlowConsumer(t *testing.T) {
+	r := require.New(t)
+	h := NewHub(Config{HistorySize: 10, BufferSize: 2})
+	slow, err := h.Subscribe(0)
+	r.NoError(err)
+	fast, err := h.Subscribe(0)
+	r.NoError(err)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		h.Publish(shopv2.ItemEvent_CREATED, &shopv2.Item{Id: "id-1"})
+		<-fast.Events()
+	}
+
+	var got int
+	for range slow.Events() {
+		got++
+	}
+	r.Equal(2, got)
+	r.ErrorIs(slow.Err(), SlowConsumerErr)
+
+	h.Publish(shopv2.ItemEvent_CREATED, &shopv2.Item{Id: "id-1"})
+	e := <-fast.Events()
+	r.Equal(h.epoch<<sequenceBits|4, e.GetRevision())
+}
+
+func TestNewHub_Epoch(t *testing.T) {
+	r := require.New(t)
+	h := NewHub(DefaultConfig)
+	e := h.Publish(shopv2.ItemEvent_CREATED, &shopv2.Item{Id: "id-1"})
+	r.Positive(e.GetRevision())
+
+	_, err := NewHub(DefaultConfig).Subscribe(e.GetRevision())
+	r.ErrorIs(err, EpochErr)
+	_, err = h.Subscribe(1)
+	r.ErrorIs(err, EpochErr)
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/plieskovsky/go-grpc-server-shop/cmd"
-	log "github.com/sirupsen/logrus"
+	"github.com/plieskovsky/go-grpc-server-shop/internal/logging"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
-		log.Fatal(err)
+		// the configured logger may not be created yet
+		logger, _, logErr := logging.New(logging.DefaultConfig)
+		if logErr != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		logger.Sugar().Fatal(err)
 	}
 }
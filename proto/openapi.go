@@ -0,0 +1,8 @@
+package proto
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 document of the REST/JSON API of the ShopService generated from shop.proto.
+//
+//go:embed shop.swagger.json
+var OpenAPI []byte
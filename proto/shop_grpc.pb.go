@@ -19,11 +19,19 @@ const _ = grpc.SupportPackageIsVersion7
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ShopServiceClient interface {
+	// Deprecated: Do not use.
+	// Returns all the items at once, use ListItems instead.
 	GetAll(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ItemsList, error)
+	ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error)
 	Get(ctx context.Context, in *ItemRequestId, opts ...grpc.CallOption) (*Item, error)
 	Create(ctx context.Context, in *CreateItemRequest, opts ...grpc.CallOption) (*Item, error)
 	Update(ctx context.Context, in *Item, opts ...grpc.CallOption) (*Item, error)
-	Remove(ctx context.Context, in *ItemRequestId, opts ...grpc.CallOption) (*empty.Empty, error)
+	// Updates only the item fields listed in the update mask. The mask is set to the fields of the PATCH request
+	// body when it is not set in the query.
+	UpdateItem(ctx context.Context, in *UpdateItemRequest, opts ...grpc.CallOption) (*Item, error)
+	Remove(ctx context.Context, in *RemoveItemRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	// Streams events about items created, updated or removed after the watch started or after the start revision.
+	WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (ShopService_WatchItemsClient, error)
 }
 
 type shopServiceClient struct {
@@ -34,6 +42,7 @@ func NewShopServiceClient(cc grpc.ClientConnInterface) ShopServiceClient {
 	return &shopServiceClient{cc}
 }
 
+// Deprecated: Do not use.
 func (c *shopServiceClient) GetAll(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ItemsList, error) {
 	out := new(ItemsList)
 	err := c.cc.Invoke(ctx, "/shop.v1.ShopService/GetAll", in, out, opts...)
@@ -43,6 +52,15 @@ func (c *shopServiceClient) GetAll(ctx context.Context, in *empty.Empty, opts ..
 	return out, nil
 }
 
+func (c *shopServiceClient) ListItems(ctx context.Context, in *ListItemsRequest, opts ...grpc.CallOption) (*ListItemsResponse, error) {
+	out := new(ListItemsResponse)
+	err := c.cc.Invoke(ctx, "/shop.v1.ShopService/ListItems", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shopServiceClient) Get(ctx context.Context, in *ItemRequestId, opts ...grpc.CallOption) (*Item, error) {
 	out := new(Item)
 	err := c.cc.Invoke(ctx, "/shop.v1.ShopService/Get", in, out, opts...)
@@ -70,7 +88,16 @@ func (c *shopServiceClient) Update(ctx context.Context, in *Item, opts ...grpc.C
 	return out, nil
 }
 
-func (c *shopServiceClient) Remove(ctx context.Context, in *ItemRequestId, opts ...grpc.CallOption) (*empty.Empty, error) {
+func (c *shopServiceClient) UpdateItem(ctx context.Context, in *UpdateItemRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, "/shop.v1.ShopService/UpdateItem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shopServiceClient) Remove(ctx context.Context, in *RemoveItemRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
 	out := new(empty.Empty)
 	err := c.cc.Invoke(ctx, "/shop.v1.ShopService/Remove", in, out, opts...)
 	if err != nil {
@@ -79,15 +106,55 @@ func (c *shopServiceClient) Remove(ctx context.Context, in *ItemRequestId, opts
 	return out, nil
 }
 
+func (c *shopServiceClient) WatchItems(ctx context.Context, in *WatchItemsRequest, opts ...grpc.CallOption) (ShopService_WatchItemsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ShopService_ServiceDesc.Streams[0], "/shop.v1.ShopService/WatchItems", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shopServiceWatchItemsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ShopService_WatchItemsClient interface {
+	Recv() (*ItemEvent, error)
+	grpc.ClientStream
+}
+
+type shopServiceWatchItemsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shopServiceWatchItemsClient) Recv() (*ItemEvent, error) {
+	m := new(ItemEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ShopServiceServer is the server API for ShopService service.
 // All implementations must embed UnimplementedShopServiceServer
 // for forward compatibility
 type ShopServiceServer interface {
+	// Deprecated: Do not use.
+	// Returns all the items at once, use ListItems instead.
 	GetAll(context.Context, *empty.Empty) (*ItemsList, error)
+	ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error)
 	Get(context.Context, *ItemRequestId) (*Item, error)
 	Create(context.Context, *CreateItemRequest) (*Item, error)
 	Update(context.Context, *Item) (*Item, error)
-	Remove(context.Context, *ItemRequestId) (*empty.Empty, error)
+	// Updates only the item fields listed in the update mask. The mask is set to the fields of the PATCH request
+	// body when it is not set in the query.
+	UpdateItem(context.Context, *UpdateItemRequest) (*Item, error)
+	Remove(context.Context, *RemoveItemRequest) (*empty.Empty, error)
+	// Streams events about items created, updated or removed after the watch started or after the start revision.
+	WatchItems(*WatchItemsRequest, ShopService_WatchItemsServer) error
 	mustEmbedUnimplementedShopServiceServer()
 }
 
@@ -98,6 +165,9 @@ type UnimplementedShopServiceServer struct {
 func (UnimplementedShopServiceServer) GetAll(context.Context, *empty.Empty) (*ItemsList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAll not implemented")
 }
+func (UnimplementedShopServiceServer) ListItems(context.Context, *ListItemsRequest) (*ListItemsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListItems not implemented")
+}
 func (UnimplementedShopServiceServer) Get(context.Context, *ItemRequestId) (*Item, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
@@ -107,9 +177,15 @@ func (UnimplementedShopServiceServer) Create(context.Context, *CreateItemRequest
 func (UnimplementedShopServiceServer) Update(context.Context, *Item) (*Item, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
-func (UnimplementedShopServiceServer) Remove(context.Context, *ItemRequestId) (*empty.Empty, error) {
+func (UnimplementedShopServiceServer) UpdateItem(context.Context, *UpdateItemRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateItem not implemented")
+}
+func (UnimplementedShopServiceServer) Remove(context.Context, *RemoveItemRequest) (*empty.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
 }
+func (UnimplementedShopServiceServer) WatchItems(*WatchItemsRequest, ShopService_WatchItemsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchItems not implemented")
+}
 func (UnimplementedShopServiceServer) mustEmbedUnimplementedShopServiceServer() {}
 
 // UnsafeShopServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -141,6 +217,24 @@ func _ShopService_GetAll_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShopService_ListItems_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServiceServer).ListItems(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shop.v1.ShopService/ListItems",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServiceServer).ListItems(ctx, req.(*ListItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShopService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ItemRequestId)
 	if err := dec(in); err != nil {
@@ -195,8 +289,26 @@ func _ShopService_Update_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShopService_UpdateItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShopServiceServer).UpdateItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shop.v1.ShopService/UpdateItem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShopServiceServer).UpdateItem(ctx, req.(*UpdateItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShopService_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ItemRequestId)
+	in := new(RemoveItemRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -208,11 +320,32 @@ func _ShopService_Remove_Handler(srv interface{}, ctx context.Context, dec func(
 		FullMethod: "/shop.v1.ShopService/Remove",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ShopServiceServer).Remove(ctx, req.(*ItemRequestId))
+		return srv.(ShopServiceServer).Remove(ctx, req.(*RemoveItemRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShopService_WatchItems_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchItemsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShopServiceServer).WatchItems(m, &shopServiceWatchItemsServer{stream})
+}
+
+type ShopService_WatchItemsServer interface {
+	Send(*ItemEvent) error
+	grpc.ServerStream
+}
+
+type shopServiceWatchItemsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shopServiceWatchItemsServer) Send(m *ItemEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ShopService_ServiceDesc is the grpc.ServiceDesc for ShopService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -224,6 +357,10 @@ var ShopService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetAll",
 			Handler:    _ShopService_GetAll_Handler,
 		},
+		{
+			MethodName: "ListItems",
+			Handler:    _ShopService_ListItems_Handler,
+		},
 		{
 			MethodName: "Get",
 			Handler:    _ShopService_Get_Handler,
@@ -236,11 +373,21 @@ var ShopService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Update",
 			Handler:    _ShopService_Update_Handler,
 		},
+		{
+			MethodName: "UpdateItem",
+			Handler:    _ShopService_UpdateItem_Handler,
+		},
 		{
 			MethodName: "Remove",
 			Handler:    _ShopService_Remove_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchItems",
+			Handler:       _ShopService_WatchItems_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "shop.proto",
 }